@@ -0,0 +1,30 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// handleShutdown asks the server to shut down gracefully, exactly as a
+// SIGTERM would, by signalling requests. It replies 202 straight away; the
+// shutdown itself happens asynchronously in main.
+func handleShutdown(requests chan<- struct{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("Shutdown requested via admin endpoint", "request_id", requestIDFromContext(r.Context()), "remote_addr", r.RemoteAddr)
+		select {
+		case requests <- struct{}{}:
+		default:
+			// A shutdown is already pending.
+		}
+		writeJSON(w, http.StatusAccepted, healthResponse{Status: "shutting down"})
+	}
+}
+
+// handleConfig serves the configuration the server is running with, as
+// resolved from flags, environment and config file and updated by any
+// reloads since, with secrets redacted.
+func handleConfig(current func() Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, current())
+	}
+}
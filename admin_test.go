@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminShutdown(t *testing.T) {
+	requests := make(chan struct{}, 1)
+	h := bearerAuthMiddleware("admin-token")(handleShutdown(requests))
+
+	if rec := serve(h, http.MethodPost, "/admin/shutdown"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("without token: status %d, want 401", rec.Code)
+	}
+	select {
+	case <-requests:
+		t.Fatal("unauthenticated request triggered a shutdown")
+	default:
+	}
+
+	post := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/admin/shutdown", nil)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := post(); code != http.StatusAccepted {
+		t.Errorf("with token: status %d, want 202", code)
+	}
+	// A second request while one is pending must not block.
+	if code := post(); code != http.StatusAccepted {
+		t.Errorf("second request: status %d, want 202", code)
+	}
+	select {
+	case <-requests:
+	default:
+		t.Fatal("authenticated request did not signal a shutdown")
+	}
+}
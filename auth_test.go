@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBasicAuth(t *testing.T) {
+	h := basicAuthMiddleware("ops", "hunter2")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, c := range []struct {
+		name       string
+		user, pass string
+		set        bool
+		want       int
+	}{
+		{"correct credentials", "ops", "hunter2", true, http.StatusOK},
+		{"wrong password", "ops", "hunter3", true, http.StatusUnauthorized},
+		{"wrong user", "admin", "hunter2", true, http.StatusUnauthorized},
+		{"missing header", "", "", false, http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if c.set {
+			req.SetBasicAuth(c.user, c.pass)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != c.want {
+			t.Errorf("%s: status %d, want %d", c.name, rec.Code, c.want)
+		}
+		if c.want == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: no WWW-Authenticate challenge", c.name)
+		}
+	}
+}
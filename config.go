@@ -0,0 +1,589 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every server setting. Values are resolved from, in order of
+// precedence, command-line flags, environment variables, the YAML file
+// named by -config, and built-in defaults.
+//
+// The yaml tag of each field is its key in the config file; the flag of the
+// same name uses dashes instead of underscores, and the env tag names its
+// environment variable. Fields tagged sensitive are redacted when the
+// configuration is logged or served by /admin/config; sensitive:"userinfo"
+// marks a list of routes whose upstream URLs may carry credentials, which
+// are stripped instead.
+type Config struct {
+	Addr          string        `yaml:"addr" env:"PORT"`
+	SocketMode    string        `yaml:"socket_mode" env:"SOCKET_MODE"`
+	StartupDelay  time.Duration `yaml:"startup_delay" env:"STARTUP_DELAY"`
+	ShutdownDelay time.Duration `yaml:"shutdown_delay" env:"SHUTDOWN_DELAY"`
+	DrainTimeout  time.Duration `yaml:"drain_timeout" env:"DRAIN_TIMEOUT"`
+
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"READ_HEADER_TIMEOUT"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"READ_TIMEOUT"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"IDLE_TIMEOUT"`
+	RequestTimeout    time.Duration `yaml:"request_timeout" env:"REQUEST_TIMEOUT"`
+	HealthCacheTTL    time.Duration `yaml:"health_cache_ttl" env:"HEALTH_CACHE_TTL"`
+
+	LogLevel        string `yaml:"log_level" env:"LOG_LEVEL"`
+	AccessLogFormat string `yaml:"access_log_format" env:"ACCESS_LOG_FORMAT"`
+	DebugDump       bool   `yaml:"debug_dump" env:"DEBUG_DUMP"`
+	OTLPEndpoint    string `yaml:"otlp_endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	ServiceName     string `yaml:"service_name" env:"OTEL_SERVICE_NAME"`
+
+	TLSCert      string        `yaml:"tls_cert" env:"TLS_CERT"`
+	TLSKey       string        `yaml:"tls_key" env:"TLS_KEY" sensitive:"true"`
+	HSTSMaxAge   time.Duration `yaml:"hsts_max_age" env:"HSTS_MAX_AGE"`
+	RedirectAddr string        `yaml:"redirect_addr" env:"REDIRECT_ADDR"`
+
+	MaxBodySize  int64  `yaml:"max_body_size" env:"MAX_BODY_SIZE"`
+	StaticDir    string `yaml:"static_dir" env:"STATIC_DIR"`
+	EchoMaxBody  int64  `yaml:"echo_max_body" env:"ECHO_MAX_BODY"`
+	Greeting     string `yaml:"greeting" env:"GREETING"`
+	GreetingFile string `yaml:"greeting_file" env:"GREETING_FILE"`
+
+	CORSOrigins []string `yaml:"cors_origins" env:"CORS_ORIGINS"`
+	ProxyRoutes []string `yaml:"proxy_routes" env:"PROXY_ROUTES" sensitive:"userinfo"`
+
+	EnablePprof bool   `yaml:"enable_pprof" env:"ENABLE_PPROF"`
+	PprofToken  string `yaml:"pprof_token" env:"PPROF_TOKEN" sensitive:"true"`
+	AdminToken  string `yaml:"admin_token" env:"ADMIN_TOKEN" sensitive:"true"`
+
+	BasicAuthPaths    []string `yaml:"basic_auth_paths" env:"BASIC_AUTH_PATHS"`
+	BasicAuthUser     string   `yaml:"basic_auth_user" env:"BASIC_AUTH_USER"`
+	BasicAuthPassword string   `yaml:"basic_auth_password" env:"BASIC_AUTH_PASSWORD" sensitive:"true"`
+
+	RateLimit     float64 `yaml:"rate_limit" env:"RATE_LIMIT"`
+	RateBurst     int     `yaml:"rate_burst" env:"RATE_BURST"`
+	TrustProxy    bool    `yaml:"trust_proxy" env:"TRUST_PROXY"`
+	ProxyProtocol bool    `yaml:"proxy_protocol" env:"PROXY_PROTOCOL"`
+
+	MaxConcurrent int `yaml:"max_concurrent" env:"MAX_CONCURRENT"`
+
+	IPAllow       []string `yaml:"ip_allow" env:"IP_ALLOW"`
+	IPDeny        []string `yaml:"ip_deny" env:"IP_DENY"`
+	IPFilterPaths []string `yaml:"ip_filter_paths" env:"IP_FILTER_PATHS"`
+
+	// greeting is the template parsed from Greeting or GreetingFile by
+	// validate. Unexported fields are derived state, not settings, so the
+	// reflection over settings skips them.
+	greeting *template.Template
+}
+
+func defaultConfig() Config {
+	return Config{
+		Addr:              defaultAddr,
+		SocketMode:        defaultSocketMode,
+		ShutdownDelay:     defaultShutdownDelay,
+		DrainTimeout:      defaultDrainTimeout,
+		ReadHeaderTimeout: defaultReadHeaderTimeout,
+		ReadTimeout:       defaultReadTimeout,
+		WriteTimeout:      defaultWriteTimeout,
+		IdleTimeout:       defaultIdleTimeout,
+		RequestTimeout:    defaultRequestTimeout,
+		LogLevel:          "info",
+		AccessLogFormat:   accessLogJSON,
+		ServiceName:       defaultServiceName,
+		HSTSMaxAge:        defaultHSTSMaxAge,
+		MaxBodySize:       defaultMaxBodySize,
+		EchoMaxBody:       defaultEchoMaxBody,
+		Greeting:          defaultGreeting,
+		RateBurst:         defaultRateBurst,
+	}
+}
+
+// registerFlags defines a flag for every Config field on fs, writing
+// into c and using its current values as the flag defaults. Secrets get no
+// flag, so they never show up in process listings.
+func (c *Config) registerFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Addr, "addr", c.Addr, "listen address as host:port, a bare port number, or unix:/path/to.sock")
+	fs.StringVar(&c.SocketMode, "socket-mode", c.SocketMode, "octal file mode for a unix: listen socket")
+	fs.DurationVar(&c.StartupDelay, "startup-delay", c.StartupDelay, "time to keep /readyz failing after startup while caches and connections warm up")
+	fs.DurationVar(&c.ShutdownDelay, "shutdown-delay", c.ShutdownDelay, "time to keep serving with /health and /readyz failing before draining starts")
+	fs.DurationVar(&c.DrainTimeout, "drain-timeout", c.DrainTimeout, "time to wait for in-flight requests to finish on shutdown")
+	fs.DurationVar(&c.ReadHeaderTimeout, "read-header-timeout", c.ReadHeaderTimeout, "maximum time to read request headers")
+	fs.DurationVar(&c.ReadTimeout, "read-timeout", c.ReadTimeout, "maximum time to read the entire request")
+	fs.DurationVar(&c.WriteTimeout, "write-timeout", c.WriteTimeout, "maximum time to write the response")
+	fs.DurationVar(&c.IdleTimeout, "idle-timeout", c.IdleTimeout, "maximum time to keep an idle keep-alive connection open")
+	fs.DurationVar(&c.RequestTimeout, "request-timeout", c.RequestTimeout, "maximum time a handler may run before the client gets a 503 (0 disables)")
+	fs.DurationVar(&c.HealthCacheTTL, "health-cache-ttl", c.HealthCacheTTL, "how long /readyz reuses a passing dependency check before running it again (0 runs checks on every probe)")
+	fs.StringVar(&c.LogLevel, "log-level", c.LogLevel, "minimum log level: debug, info, warn or error")
+	fs.StringVar(&c.AccessLogFormat, "access-log-format", c.AccessLogFormat, "access log format: json (with the other logs on stderr) or clf (Combined Log Format on stdout)")
+	fs.BoolVar(&c.DebugDump, "debug-dump", c.DebugDump, "log every raw request and response status and headers, with credentials redacted (for debugging only)")
+	fs.StringVar(&c.OTLPEndpoint, "otlp-endpoint", c.OTLPEndpoint, "base URL of an OTLP/HTTP collector to export traces to (tracing is off when empty)")
+	fs.StringVar(&c.ServiceName, "service-name", c.ServiceName, "service.name reported with exported traces")
+	fs.StringVar(&c.TLSCert, "tls-cert", c.TLSCert, "path to a PEM certificate; enables TLS together with -tls-key")
+	fs.StringVar(&c.TLSKey, "tls-key", c.TLSKey, "path to the PEM private key for -tls-cert")
+	fs.DurationVar(&c.HSTSMaxAge, "hsts-max-age", c.HSTSMaxAge, "max-age for the Strict-Transport-Security header in TLS mode (0 disables)")
+	fs.StringVar(&c.RedirectAddr, "redirect-addr", c.RedirectAddr, "address of a plain HTTP listener that redirects every request to HTTPS (requires TLS)")
+	fs.Int64Var(&c.MaxBodySize, "max-body-size", c.MaxBodySize, "maximum request body size in bytes for any endpoint")
+	fs.StringVar(&c.StaticDir, "static-dir", c.StaticDir, "directory of files to serve under /static/ (disabled when empty)")
+	fs.Int64Var(&c.EchoMaxBody, "echo-max-body", c.EchoMaxBody, "maximum request body size in bytes accepted by /echo")
+	fs.StringVar(&c.Greeting, "greeting", c.Greeting, "text/template for the greeting served at /, with {{.Hostname}} and {{.Path}} available")
+	fs.StringVar(&c.GreetingFile, "greeting-file", c.GreetingFile, "file holding the greeting template; overrides -greeting")
+	fs.Var(listValue{&c.CORSOrigins}, "cors-origins", "comma-separated origins allowed to make cross-origin requests (\"*\" for any)")
+	fs.Var(listValue{&c.ProxyRoutes}, "proxy-routes", "comma-separated /prefix=http://upstream routes to reverse-proxy")
+	fs.BoolVar(&c.EnablePprof, "enable-pprof", c.EnablePprof, "serve runtime profiles under /debug/pprof/ (requires $PPROF_TOKEN)")
+	fs.Var(listValue{&c.BasicAuthPaths}, "basic-auth-paths", "comma-separated route patterns that require basic auth (e.g. /metrics)")
+	fs.StringVar(&c.BasicAuthUser, "basic-auth-user", c.BasicAuthUser, "username for -basic-auth-paths (password from $BASIC_AUTH_PASSWORD)")
+	fs.Float64Var(&c.RateLimit, "rate-limit", c.RateLimit, "requests per second allowed per client IP (0 disables rate limiting)")
+	fs.IntVar(&c.RateBurst, "rate-burst", c.RateBurst, "requests a client may make in a burst before -rate-limit applies")
+	fs.BoolVar(&c.TrustProxy, "trust-proxy", c.TrustProxy, "take the client IP from X-Forwarded-For (only behind a trusted proxy)")
+	fs.BoolVar(&c.ProxyProtocol, "proxy-protocol", c.ProxyProtocol, "require a PROXY protocol v1/v2 header on every connection, to -addr and -redirect-addr alike, and take the client address from it (only behind an L4 load balancer)")
+	fs.IntVar(&c.MaxConcurrent, "max-concurrent", c.MaxConcurrent, "maximum requests handled at once; excess requests get a 503 (0 means unlimited)")
+	fs.Var(listValue{&c.IPAllow}, "ip-allow", "comma-separated CIDRs allowed to connect (empty allows any address not in -ip-deny)")
+	fs.Var(listValue{&c.IPDeny}, "ip-deny", "comma-separated CIDRs refused with 403, even if also in -ip-allow")
+	fs.Var(listValue{&c.IPFilterPaths}, "ip-filter-paths", "comma-separated route patterns -ip-allow and -ip-deny apply to (empty means every route)")
+}
+
+// loadConfig resolves the configuration from the command-line arguments
+// (without the program name), the environment as seen through getenv and
+// the config file, then validates the result. checkOnly reports whether
+// -check was given, asking for the configuration to be checked rather than
+// served.
+func loadConfig(args []string, getenv func(string) string) (cfg Config, checkOnly bool, err error) {
+	cfg = defaultConfig()
+
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	configPath := fs.String("config", "", "path to a YAML config file")
+	check := fs.Bool("check", false, "check the configuration, including that TLS files can be loaded, and exit without serving")
+	flags := cfg
+	flags.registerFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return Config{}, false, err
+	}
+	if fs.NArg() > 0 {
+		return Config{}, false, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	if *configPath != "" {
+		data, err := os.ReadFile(*configPath)
+		if err != nil {
+			return Config{}, false, err
+		}
+		if err := cfg.decodeYAML(data); err != nil {
+			return Config{}, false, fmt.Errorf("%s: %w", *configPath, err)
+		}
+	}
+	if err := cfg.applyEnv(getenv); err != nil {
+		return Config{}, false, err
+	}
+
+	// Only flags given on the command line override the lower layers.
+	dst, src := reflect.ValueOf(&cfg).Elem(), reflect.ValueOf(flags)
+	fs.Visit(func(f *flag.Flag) {
+		if i, ok := configFieldByKey(strings.ReplaceAll(f.Name, "-", "_")); ok {
+			dst.Field(i).Set(src.Field(i))
+		}
+	})
+
+	if err := cfg.validate(); err != nil {
+		return Config{}, false, err
+	}
+	return cfg, *check, nil
+}
+
+// decodeYAML overlays the settings in a YAML config file onto c. The file
+// must be a mapping of setting names to scalars or lists of scalars.
+// Unknown keys are rejected so typos don't go unnoticed.
+func (c *Config) decodeYAML(data []byte) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if len(doc.Content) == 0 {
+		return nil // an empty file
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: expected a mapping of settings", root.Line)
+	}
+
+	v := reflect.ValueOf(c).Elem()
+	seen := make(map[string]bool, len(root.Content)/2)
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		keyNode, valueNode := root.Content[i], root.Content[i+1]
+		key := keyNode.Value
+		field, ok := configFieldByKey(key)
+		if !ok {
+			return fmt.Errorf("unknown setting %q", key)
+		}
+		if seen[key] {
+			return fmt.Errorf("line %d: duplicate key %q", keyNode.Line, key)
+		}
+		seen[key] = true
+
+		raw, err := yamlSettingValue(valueNode)
+		if err != nil {
+			return fmt.Errorf("%s: line %d: %w", key, valueNode.Line, err)
+		}
+		if err := setConfigField(v.Field(field), raw); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// yamlSettingValue returns a scalar node as a string and a sequence of
+// scalars as a []string, the forms setConfigField accepts. Null is the
+// empty string.
+func yamlSettingValue(n *yaml.Node) (any, error) {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	switch n.Kind {
+	case yaml.ScalarNode:
+		if n.Tag == "!!null" {
+			return "", nil
+		}
+		return n.Value, nil
+	case yaml.SequenceNode:
+		var list []string
+		if err := n.Decode(&list); err != nil {
+			return nil, errors.New("expected a list of plain values")
+		}
+		if list == nil {
+			list = []string{}
+		}
+		return list, nil
+	}
+	return nil, errors.New("expected a value or a list of values")
+}
+
+// applyEnv overlays settings from environment variables onto c.
+func (c *Config) applyEnv(getenv func(string) string) error {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		raw := getenv(name)
+		if raw == "" {
+			continue
+		}
+		if err := setConfigField(v.Field(i), raw); err != nil {
+			return fmt.Errorf("$%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// validate checks the merged configuration and normalizes the listen
+// address.
+func (c *Config) validate() error {
+	addr, err := validateAddr(c.Addr)
+	if err != nil {
+		return fmt.Errorf("invalid listen address: %w", err)
+	}
+	c.Addr = addr
+	if _, err := parseSocketMode(c.SocketMode); err != nil {
+		return err
+	}
+
+	v := reflect.ValueOf(*c)
+	for i := 0; i < v.NumField(); i++ {
+		if !v.Type().Field(i).IsExported() {
+			continue
+		}
+		if d, ok := v.Field(i).Interface().(time.Duration); ok && d < 0 {
+			return fmt.Errorf("%s must not be negative", v.Type().Field(i).Tag.Get("yaml"))
+		}
+	}
+
+	if _, err := parseLogLevel(c.LogLevel); err != nil {
+		return err
+	}
+	if c.AccessLogFormat != accessLogJSON && c.AccessLogFormat != accessLogCLF {
+		return fmt.Errorf("access_log_format must be %q or %q, got %q", accessLogJSON, accessLogCLF, c.AccessLogFormat)
+	}
+	if c.OTLPEndpoint != "" {
+		u, err := url.Parse(c.OTLPEndpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("otlp_endpoint must be an http or https URL, got %q", c.OTLPEndpoint)
+		}
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return fmt.Errorf("tls_cert and tls_key must be set together to enable TLS")
+	}
+	if c.RedirectAddr != "" {
+		if c.TLSCert == "" {
+			return fmt.Errorf("redirect_addr requires TLS to be enabled")
+		}
+		if strings.HasPrefix(c.Addr, unixAddrPrefix) {
+			return fmt.Errorf("redirect_addr requires addr to be a TCP address")
+		}
+		addr, err := validateAddr(c.RedirectAddr)
+		if err != nil {
+			return fmt.Errorf("invalid redirect address: %w", err)
+		}
+		c.RedirectAddr = addr
+	}
+	if c.StaticDir != "" {
+		info, err := os.Stat(c.StaticDir)
+		if err != nil {
+			return fmt.Errorf("static_dir: %w", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("static_dir: %s is not a directory", c.StaticDir)
+		}
+	}
+	if c.MaxBodySize < 1 {
+		return fmt.Errorf("max_body_size must be at least 1")
+	}
+	if c.EchoMaxBody < 1 {
+		return fmt.Errorf("echo_max_body must be at least 1")
+	}
+	if c.greeting, err = c.greetingTemplate(); err != nil {
+		return err
+	}
+	if _, err := parseProxyRoutes(c.ProxyRoutes); err != nil {
+		return err
+	}
+	if c.EnablePprof && c.PprofToken == "" {
+		return fmt.Errorf("enable_pprof requires pprof_token to be set")
+	}
+	if len(c.BasicAuthPaths) > 0 && (c.BasicAuthUser == "" || c.BasicAuthPassword == "") {
+		return fmt.Errorf("basic_auth_paths requires basic_auth_user and basic_auth_password to be set")
+	}
+	if c.RateLimit < 0 {
+		return fmt.Errorf("rate_limit must not be negative")
+	}
+	if c.RateBurst < 1 {
+		return fmt.Errorf("rate_burst must be at least 1")
+	}
+	if c.MaxConcurrent < 0 {
+		return fmt.Errorf("max_concurrent must not be negative")
+	}
+	if _, err := parseCIDRs(c.IPAllow); err != nil {
+		return fmt.Errorf("ip_allow: %w", err)
+	}
+	if _, err := parseCIDRs(c.IPDeny); err != nil {
+		return fmt.Errorf("ip_deny: %w", err)
+	}
+	return nil
+}
+
+// check goes beyond validate for -check, testing the settings against the
+// environment the server would start in: the TLS certificate and key must
+// load, and the directory for a unix: socket must exist.
+func (c *Config) check() error {
+	if c.TLSCert != "" {
+		if _, err := tls.LoadX509KeyPair(c.TLSCert, c.TLSKey); err != nil {
+			return fmt.Errorf("tls_cert/tls_key: %w", err)
+		}
+	}
+	if path, ok := strings.CutPrefix(c.Addr, unixAddrPrefix); ok {
+		dir := filepath.Dir(path)
+		info, err := os.Stat(dir)
+		if err != nil {
+			return fmt.Errorf("addr: socket directory: %w", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("addr: %s is not a directory", dir)
+		}
+	}
+	return nil
+}
+
+// validateAddr checks that addr is a usable host:port or "unix:" socket
+// path. A bare port number is accepted for compatibility with platforms that
+// set $PORT that way.
+func validateAddr(addr string) (string, error) {
+	if path, ok := strings.CutPrefix(addr, unixAddrPrefix); ok {
+		if path == "" {
+			return "", fmt.Errorf("%q: missing socket path", addr)
+		}
+		return addr, nil
+	}
+	if _, err := strconv.Atoi(addr); err == nil {
+		addr = ":" + addr
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("%q: %w", addr, err)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return "", fmt.Errorf("%q: port must be a number between 0 and 65535", addr)
+	}
+	return addr, nil
+}
+
+// LogValue renders the configuration for structured logs, with sensitive
+// fields redacted.
+func (c Config) LogValue() slog.Value {
+	fields := c.redacted()
+	attrs := make([]slog.Attr, 0, len(fields))
+	for _, f := range fields {
+		attrs = append(attrs, slog.Any(f.key, f.value))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// MarshalJSON encodes the configuration as an object keyed by the yaml
+// names, in field order, with sensitive fields redacted.
+func (c Config) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range c.redacted() {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(f.key)
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.key, err)
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+type configField struct {
+	key   string
+	value any
+}
+
+// redacted returns every setting keyed by its yaml name, with non-empty
+// sensitive values replaced by "***", credentials stripped from proxy route
+// upstreams, and durations in their string form.
+func (c Config) redacted() []configField {
+	v := reflect.ValueOf(c)
+	t := v.Type()
+	fields := make([]configField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		val := v.Field(i).Interface()
+		sensitive := f.Tag.Get("sensitive")
+		if sensitive == "true" && !v.Field(i).IsZero() {
+			val = "***"
+		} else if sensitive == "userinfo" {
+			val = redactProxyRoutes(val.([]string))
+		} else if d, ok := val.(time.Duration); ok {
+			val = d.String()
+		}
+		fields = append(fields, configField{key: f.Tag.Get("yaml"), value: val})
+	}
+	return fields
+}
+
+// configFieldByKey returns the index of the Config field with the given
+// yaml key.
+func configFieldByKey(key string) (int, bool) {
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("yaml") == key {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// setConfigField parses raw, either a string or a []string from the YAML
+// parser, into the Config field f.
+func setConfigField(f reflect.Value, raw any) error {
+	if list, ok := raw.([]string); ok {
+		if f.Kind() == reflect.Slice {
+			f.Set(reflect.ValueOf(append([]string(nil), list...)))
+			return nil
+		}
+		if len(list) > 0 {
+			return fmt.Errorf("expected a single value, got a list")
+		}
+		raw = ""
+	}
+	s := strings.TrimSpace(raw.(string))
+
+	if f.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(d))
+		return nil
+	}
+
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", s)
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", s)
+		}
+		f.SetInt(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+		f.SetFloat(n)
+	case reflect.Slice:
+		f.Set(reflect.ValueOf(splitList(s)))
+	default:
+		return fmt.Errorf("unsupported setting type %s", f.Type())
+	}
+	return nil
+}
+
+// listValue is a flag.Value for a []string setting given as a
+// comma-separated list.
+type listValue struct {
+	p *[]string
+}
+
+func (l listValue) String() string {
+	if l.p == nil {
+		return ""
+	}
+	return strings.Join(*l.p, ",")
+}
+
+func (l listValue) Set(s string) error {
+	*l.p = splitList(s)
+	return nil
+}
+
+// splitList splits a comma-separated list, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	corsAllowMethods = "GET, HEAD, POST, OPTIONS"
+	corsAllowHeaders = "Authorization, Content-Type, " + requestIDHeader
+	corsMaxAge       = "600"
+)
+
+// corsMiddleware implements CORS for the given origin allowlist. Listed
+// origins are reflected back exactly and may send credentials. A "*" entry
+// allows any origin, but only with a literal "*" response so browsers never
+// attach credentials. Preflight requests are answered here and not passed
+// on.
+func corsMiddleware(origins []string) func(http.Handler) http.Handler {
+	allowed := make(map[string]bool, len(origins))
+	wildcard := false
+	for _, o := range origins {
+		if o == "*" {
+			wildcard = true
+			continue
+		}
+		allowed[strings.TrimRight(o, "/")] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			h := w.Header()
+			h.Add("Vary", "Origin")
+
+			switch {
+			case allowed[origin]:
+				h.Set("Access-Control-Allow-Origin", origin)
+				h.Set("Access-Control-Allow-Credentials", "true")
+			case wildcard:
+				h.Set("Access-Control-Allow-Origin", "*")
+			default:
+				if isPreflight(r) {
+					writeJSON(w, http.StatusForbidden, errorResponse{Error: "origin not allowed"})
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if isPreflight(r) {
+				h.Set("Access-Control-Allow-Methods", corsAllowMethods)
+				h.Set("Access-Control-Allow-Headers", corsAllowHeaders)
+				h.Set("Access-Control-Max-Age", corsMaxAge)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			h.Set("Access-Control-Expose-Headers", requestIDHeader)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func corsRequest(method, origin string) *http.Request {
+	req := httptest.NewRequest(method, "/", nil)
+	req.Header.Set("Origin", origin)
+	return req
+}
+
+func TestCORS(t *testing.T) {
+	reached := false
+	h := corsMiddleware([]string{"https://app.example/"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, corsRequest(http.MethodGet, "https://app.example"))
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example" {
+		t.Errorf("allowed origin: Access-Control-Allow-Origin = %q", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("allowed origin: Access-Control-Allow-Credentials = %q, want true", got)
+	}
+	if !reached {
+		t.Error("allowed origin: handler not called")
+	}
+
+	reached = false
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, corsRequest(http.MethodGet, "https://evil.example"))
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("disallowed origin: Access-Control-Allow-Origin = %q, want none", got)
+	}
+	if !reached {
+		t.Error("disallowed simple request: handler not called; the browser, not the server, should block it")
+	}
+
+	reached = false
+	req := corsRequest(http.MethodOptions, "https://app.example")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent || reached {
+		t.Errorf("preflight: status %d (handler called: %v), want 204 answered by the middleware", rec.Code, reached)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Methods"); got != corsAllowMethods {
+		t.Errorf("preflight: Access-Control-Allow-Methods = %q", got)
+	}
+	if got := rec.Header().Get("Access-Control-Max-Age"); got != corsMaxAge {
+		t.Errorf("preflight: Access-Control-Max-Age = %q", got)
+	}
+
+	req = corsRequest(http.MethodOptions, "https://evil.example")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("disallowed preflight: status %d, want 403", rec.Code)
+	}
+}
+
+func TestCORSWildcard(t *testing.T) {
+	h := corsMiddleware([]string{"*"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, corsRequest(http.MethodGet, "https://anyone.example"))
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("Access-Control-Allow-Credentials = %q with a wildcard, want none", got)
+	}
+}
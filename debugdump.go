@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+)
+
+// debugDumpMaxBody caps how much of each request body -debug-dump logs.
+const debugDumpMaxBody = 4 << 10
+
+// redactedHeaders are replaced with "***" in dumps so credentials don't end
+// up in the logs.
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// debugDumpMiddleware logs every raw request, with up to maxBody bytes of
+// its body, and the status and headers of the response. The body is
+// buffered only as far as it is logged; the handler still reads all of it.
+// It is meant for reproducing client bugs, not for production traffic.
+func debugDumpMiddleware(maxBody int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			head := r.Clone(r.Context())
+			head.Header = redactHeaders(r.Header)
+			dump, err := httputil.DumpRequest(head, false)
+			if err != nil {
+				slog.Warn("Failed to dump request", "request_id", requestIDFromContext(r.Context()), "error", err)
+			}
+
+			var body []byte
+			if r.Body != nil && r.Body != http.NoBody {
+				body, err = io.ReadAll(io.LimitReader(r.Body, maxBody))
+				if err != nil {
+					slog.Warn("Failed to read request body for dump", "request_id", requestIDFromContext(r.Context()), "error", err)
+				}
+				// Put back what was read in front of what wasn't.
+				r.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+			}
+			slog.Info("Request dump",
+				"request_id", requestIDFromContext(r.Context()),
+				"request", string(dump)+string(body),
+				"body_truncated", int64(len(body)) == maxBody && r.ContentLength != int64(len(body)),
+			)
+
+			rw := newResponseWriter(w)
+			next.ServeHTTP(rw, r)
+			slog.Info("Response dump",
+				"request_id", requestIDFromContext(r.Context()),
+				"status", rw.status,
+				"headers", redactHeaders(rw.Header()),
+			)
+		})
+	}
+}
+
+func redactHeaders(h http.Header) http.Header {
+	h = h.Clone()
+	for _, name := range redactedHeaders {
+		if _, ok := h[name]; ok {
+			h[name] = []string{"***"}
+		}
+	}
+	return h
+}
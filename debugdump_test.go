@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDebugDumpLeavesBodyForHandler(t *testing.T) {
+	var logs bytes.Buffer
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(slog.New(slog.NewJSONHandler(io.Discard, nil))) })
+
+	body := strings.Repeat("a", debugDumpMaxBody) + strings.Repeat("b", 100)
+	var got string
+	h := debugDumpMiddleware(debugDumpMaxBody)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got = string(b)
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got != body {
+		t.Errorf("handler read %d bytes, want all %d", len(got), len(body))
+	}
+
+	var dump struct {
+		Request   string `json:"request"`
+		Truncated bool   `json:"body_truncated"`
+	}
+	line, _, _ := strings.Cut(logs.String(), "\n")
+	if err := json.Unmarshal([]byte(line), &dump); err != nil {
+		t.Fatal(err)
+	}
+	if !dump.Truncated || !strings.HasSuffix(dump.Request, "\r\n\r\n"+strings.Repeat("a", debugDumpMaxBody)) {
+		t.Errorf("dump not truncated at %d body bytes: truncated=%v", debugDumpMaxBody, dump.Truncated)
+	}
+	if strings.Contains(dump.Request, "secret") {
+		t.Error("dump contains the Authorization header value")
+	}
+}
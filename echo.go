@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+const defaultEchoMaxBody = 64 << 10
+
+type echoResponse struct {
+	Method  string              `json:"method"`
+	Path    string              `json:"path"`
+	Headers map[string][]string `json:"headers"`
+	Query   map[string][]string `json:"query"`
+	Body    string              `json:"body"`
+}
+
+// handleEcho reflects the request back to the client as JSON, for debugging
+// client integrations. Bodies larger than maxBody are rejected with 413.
+func handleEcho(maxBody int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeJSON(w, http.StatusRequestEntityTooLarge, errorResponse{Error: "request body too large"})
+				return
+			}
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "could not read request body"})
+			return
+		}
+		writeJSON(w, http.StatusOK, echoResponse{
+			Method:  r.Method,
+			Path:    r.URL.Path,
+			Headers: r.Header,
+			Query:   r.URL.Query(),
+			Body:    string(body),
+		})
+	}
+}
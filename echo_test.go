@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEchoReflectsRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/echo?a=1&a=2", strings.NewReader(`{"hello":"world"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Custom", "yes")
+	rec := httptest.NewRecorder()
+	handleEcho(1024).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", rec.Code)
+	}
+	var resp echoResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Method != http.MethodPost || resp.Path != "/echo" || resp.Body != `{"hello":"world"}` {
+		t.Errorf("echoed %s %s body %q", resp.Method, resp.Path, resp.Body)
+	}
+	if got := resp.Query["a"]; len(got) != 2 || got[0] != "1" || got[1] != "2" {
+		t.Errorf("query a = %q, want [1 2]", got)
+	}
+	if got := resp.Headers["X-Custom"]; len(got) != 1 || got[0] != "yes" {
+		t.Errorf("header X-Custom = %q, want [yes]", got)
+	}
+}
+
+func TestEchoRejectsLargeBody(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handleEcho(16).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(strings.Repeat("x", 17))))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status %d, want 413", rec.Code)
+	}
+}
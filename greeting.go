@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+)
+
+const defaultGreeting = "Hello from 1st-repo!"
+
+// greetingData is what a greeting template can refer to, as in
+// "Hello from {{.Hostname}}!".
+type greetingData struct {
+	Hostname string
+	Path     string
+}
+
+// greetingTemplate parses the greeting served at /: the contents of
+// greeting_file if set, otherwise greeting. The template is also executed
+// once against sample data, so references to unknown fields are reported
+// at startup rather than on the first request.
+func (c *Config) greetingTemplate() (*template.Template, error) {
+	name, text := "greeting", c.Greeting
+	if c.GreetingFile != "" {
+		data, err := os.ReadFile(c.GreetingFile)
+		if err != nil {
+			return nil, fmt.Errorf("greeting_file: %w", err)
+		}
+		name, text = c.GreetingFile, strings.TrimRight(string(data), "\n")
+	}
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid greeting template: %w", err)
+	}
+	if err := tmpl.Execute(io.Discard, greetingData{Hostname: "localhost", Path: "/"}); err != nil {
+		return nil, fmt.Errorf("invalid greeting template: %w", err)
+	}
+	return tmpl, nil
+}
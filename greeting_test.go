@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func getRoot(t *testing.T, cfg Config, path string) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handleRoot(cfg.greeting).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", rec.Code)
+	}
+	return rec.Body.String()
+}
+
+func TestGreetingDefault(t *testing.T) {
+	cfg := mustLoadConfig(t)
+	want := "Hello from 1st-repo!\nHostname: " + hostname + "\nPath: /\n"
+	if got := getRoot(t, cfg, "/"); got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+}
+
+func TestGreetingCustom(t *testing.T) {
+	cfg := mustLoadConfig(t, "-greeting", "Hi from {{.Hostname}} at {{.Path}}")
+	if got, want := getRoot(t, cfg, "/"), "Hi from "+hostname+" at /\nHostname: "+hostname+"\nPath: /\n"; got != want {
+		t.Errorf("flag template: body = %q, want %q", got, want)
+	}
+
+	file := filepath.Join(t.TempDir(), "greeting.tmpl")
+	if err := os.WriteFile(file, []byte("From file: {{.Path}}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg = mustLoadConfig(t, "-greeting", "ignored", "-greeting-file", file)
+	if got, want := getRoot(t, cfg, "/"), "From file: /\nHostname: "+hostname+"\nPath: /\n"; got != want {
+		t.Errorf("file template: body = %q, want %q", got, want)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "application/json")
+	rec := httptest.NewRecorder()
+	handleRoot(cfg.greeting).ServeHTTP(rec, req)
+	if !strings.Contains(rec.Body.String(), `"message":"From file: /"`) {
+		t.Errorf("JSON body = %s, want the rendered greeting as message", rec.Body)
+	}
+}
+
+func TestGreetingMalformed(t *testing.T) {
+	for _, tmpl := range []string{
+		"Hello {{.Hostname",  // parse error
+		"Hello {{.Nope}}",    // unknown field, caught by the trial execution
+		"{{template \"x\"}}", // undefined template
+	} {
+		_, _, err := loadConfig([]string{"-greeting", tmpl}, noEnv)
+		if err == nil || !strings.Contains(err.Error(), "invalid greeting template") {
+			t.Errorf("loadConfig(-greeting %q) error = %v, want invalid greeting template", tmpl, err)
+		}
+	}
+
+	_, _, err := loadConfig([]string{"-greeting-file", filepath.Join(t.TempDir(), "missing")}, noEnv)
+	if err == nil || !strings.Contains(err.Error(), "greeting_file") {
+		t.Errorf("missing greeting_file: error = %v", err)
+	}
+}
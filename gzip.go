@@ -0,0 +1,200 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// minGzipSize is the smallest response body worth compressing; below this
+// the gzip framing overhead outweighs the savings.
+const minGzipSize = 1024
+
+// incompressibleTypes are content type prefixes that are already compressed.
+var incompressibleTypes = []string{
+	"image/", "video/", "audio/", "font/woff",
+	"application/gzip", "application/x-gzip", "application/zip",
+	"application/zstd", "application/x-7z-compressed", "application/x-rar-compressed",
+}
+
+var gzipWriters = sync.Pool{
+	New: func() any { return gzip.NewWriter(nil) },
+}
+
+// gzipMiddleware compresses responses for clients that send
+// Accept-Encoding: gzip, skipping small bodies and content that is already
+// compressed. Protocol upgrades such as WebSocket handshakes pass through
+// untouched, since the handler needs to hijack the connection.
+func gzipMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !acceptsGzip(r) || isUpgrade(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		defer gw.Close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip reports whether the request's Accept-Encoding allows gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		q, ok := strings.CutPrefix(strings.TrimSpace(params), "q=")
+		if !ok {
+			return true
+		}
+		v, err := strconv.ParseFloat(q, 64)
+		return err == nil && v > 0
+	}
+	return false
+}
+
+// isUpgrade reports whether the request asks to switch protocols.
+func isUpgrade(r *http.Request) bool {
+	if r.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, v := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter buffers the start of the response until it knows
+// whether the body is large enough to compress, then either streams the
+// rest through a gzip.Writer or passes it through unchanged.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	decided     bool
+	buf         []byte
+	gz          *gzip.Writer
+}
+
+func (g *gzipResponseWriter) WriteHeader(code int) {
+	if g.wroteHeader {
+		return
+	}
+	// Informational responses are sent straight away and don't fix the
+	// final status.
+	if code >= 100 && code < 200 {
+		g.ResponseWriter.WriteHeader(code)
+		return
+	}
+	g.status = code
+	g.wroteHeader = true
+}
+
+func (g *gzipResponseWriter) Write(b []byte) (int, error) {
+	g.wroteHeader = true
+	if g.decided {
+		if g.gz != nil {
+			return g.gz.Write(b)
+		}
+		return g.ResponseWriter.Write(b)
+	}
+	g.buf = append(g.buf, b...)
+	if len(g.buf) >= minGzipSize {
+		if err := g.decide(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// decide sends the response headers, choosing compression based on what has
+// been buffered so far, and flushes the buffer.
+func (g *gzipResponseWriter) decide() error {
+	g.decided = true
+	h := g.Header()
+	if h.Get("Content-Type") == "" && len(g.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(g.buf))
+	}
+
+	if g.shouldCompress() {
+		h.Set("Content-Encoding", "gzip")
+		h.Add("Vary", "Accept-Encoding")
+		h.Del("Content-Length")
+		g.gz = gzipWriters.Get().(*gzip.Writer)
+		g.gz.Reset(g.ResponseWriter)
+		g.ResponseWriter.WriteHeader(g.status)
+		_, err := g.gz.Write(g.buf)
+		g.buf = nil
+		return err
+	}
+
+	g.ResponseWriter.WriteHeader(g.status)
+	_, err := g.ResponseWriter.Write(g.buf)
+	g.buf = nil
+	return err
+}
+
+func (g *gzipResponseWriter) shouldCompress() bool {
+	if len(g.buf) < minGzipSize || g.Header().Get("Content-Encoding") != "" {
+		return false
+	}
+	if g.status == http.StatusNoContent || g.status == http.StatusNotModified {
+		return false
+	}
+	ct := strings.ToLower(g.Header().Get("Content-Type"))
+	if strings.HasPrefix(ct, "image/svg") {
+		return true
+	}
+	for _, prefix := range incompressibleTypes {
+		if strings.HasPrefix(ct, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// Flush sends any buffered data to the client, committing to the current
+// compression decision.
+func (g *gzipResponseWriter) Flush() {
+	if !g.decided {
+		g.decide()
+	}
+	if g.gz != nil {
+		g.gz.Flush()
+	}
+	http.NewResponseController(g.ResponseWriter).Flush()
+}
+
+// Close finishes the response, flushing any body that never reached the
+// compression threshold.
+func (g *gzipResponseWriter) Close() error {
+	if !g.decided {
+		if !g.wroteHeader && len(g.buf) == 0 {
+			// Nothing was written; let net/http send its implicit 200.
+			return nil
+		}
+		if err := g.decide(); err != nil {
+			return err
+		}
+	}
+	if g.gz == nil {
+		return nil
+	}
+	err := g.gz.Close()
+	g.gz.Reset(nil)
+	gzipWriters.Put(g.gz)
+	g.gz = nil
+	return err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (g *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGzipRoundTrip(t *testing.T) {
+	text := strings.Repeat("The quick brown fox jumps over the lazy dog.\n", 100)
+	h := gzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		// Several writes, the first below the compression threshold.
+		io.WriteString(w, text[:10])
+		io.WriteString(w, text[10:])
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	if !strings.Contains(rec.Header().Get("Vary"), "Accept-Encoding") {
+		t.Errorf("Vary = %q, want it to include Accept-Encoding", rec.Header().Get("Vary"))
+	}
+	if rec.Body.Len() >= len(text) {
+		t.Errorf("compressed body is %d bytes, not smaller than the %d byte original", rec.Body.Len(), len(text))
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != text {
+		t.Errorf("decompressed body differs from the original")
+	}
+}
+
+func TestGzipSkipsSmallAndUnrequested(t *testing.T) {
+	small := gzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "tiny")
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	small.ServeHTTP(rec, req)
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != "tiny" {
+		t.Errorf("small body: Content-Encoding %q body %q, want it uncompressed", rec.Header().Get("Content-Encoding"), rec.Body)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip;q=0, br")
+	if acceptsGzip(req) {
+		t.Error("acceptsGzip with gzip;q=0 = true, want false")
+	}
+}
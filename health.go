@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultCheckTimeout bounds each readiness dependency check so one slow
+// dependency can't stall the probe.
+const defaultCheckTimeout = 2 * time.Second
+
+// ready reports whether the server should receive traffic. It is set once
+// the listener is about to start, or -startup-delay after that, and cleared
+// as soon as shutdown begins.
+var ready atomic.Bool
+
+// shuttingDown is set as soon as a shutdown is requested, so that /health
+// and /readyz report unhealthy while in-flight requests drain.
+var shuttingDown atomic.Bool
+
+// healthChecks holds the dependency checks consulted by /readyz.
+var healthChecks = newHealthRegistry(defaultCheckTimeout)
+
+// HealthChecker reports whether a dependency is usable. Check should
+// respect ctx cancellation.
+type HealthChecker interface {
+	Check(ctx context.Context) error
+}
+
+// HealthCheckerFunc adapts a function to the HealthChecker interface.
+type HealthCheckerFunc func(ctx context.Context) error
+
+func (f HealthCheckerFunc) Check(ctx context.Context) error { return f(ctx) }
+
+type namedChecker struct {
+	name    string
+	checker HealthChecker
+
+	// mu serializes runs of the check, so concurrent probes within the
+	// cache window share one result. passedAt is when it last succeeded.
+	mu       sync.Mutex
+	passedAt time.Time
+}
+
+// healthRegistry is a named set of HealthCheckers run concurrently, each
+// under its own timeout. With a cache TTL set, a check that passed is not
+// run again until the TTL has elapsed; failures are never cached, so a
+// recovering dependency is noticed on the next probe.
+type healthRegistry struct {
+	mu       sync.RWMutex
+	checks   []*namedChecker
+	timeout  time.Duration
+	cacheTTL time.Duration
+	now      func() time.Time
+}
+
+func newHealthRegistry(timeout time.Duration) *healthRegistry {
+	return &healthRegistry{timeout: timeout, now: time.Now}
+}
+
+// Register adds a named check to the registry.
+func (hr *healthRegistry) Register(name string, c HealthChecker) {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+	hr.checks = append(hr.checks, &namedChecker{name: name, checker: c})
+}
+
+// SetCacheTTL sets how long a passing result is reused before the check is
+// run again. Zero runs every check on every probe.
+func (hr *healthRegistry) SetCacheTTL(ttl time.Duration) {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+	hr.cacheTTL = ttl
+}
+
+// Run executes every registered check, or reuses its cached pass, and
+// returns the sorted names of those that failed or did not finish within
+// the timeout.
+func (hr *healthRegistry) Run(ctx context.Context) []string {
+	hr.mu.RLock()
+	checks, ttl := hr.checks, hr.cacheTTL
+	hr.mu.RUnlock()
+
+	var (
+		mu     sync.Mutex
+		failed []string
+		wg     sync.WaitGroup
+	)
+	for _, nc := range checks {
+		wg.Add(1)
+		go func(nc *namedChecker) {
+			defer wg.Done()
+			if err := hr.runCached(ctx, nc, ttl); err != nil {
+				slog.Warn("Health check failed", "check", nc.name, "error", err)
+				mu.Lock()
+				failed = append(failed, nc.name)
+				mu.Unlock()
+			}
+		}(nc)
+	}
+	wg.Wait()
+	sort.Strings(failed)
+	return failed
+}
+
+// runCached returns nil without running nc if it passed within ttl, and
+// otherwise runs it and records the outcome.
+func (hr *healthRegistry) runCached(ctx context.Context, nc *namedChecker, ttl time.Duration) error {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	if ttl > 0 && !nc.passedAt.IsZero() && hr.now().Sub(nc.passedAt) < ttl {
+		return nil
+	}
+	if err := hr.runOne(ctx, nc.checker); err != nil {
+		nc.passedAt = time.Time{}
+		return err
+	}
+	nc.passedAt = hr.now()
+	return nil
+}
+
+// runOne runs c with the registry timeout, giving up on checks that ignore
+// their context.
+func (hr *healthRegistry) runOne(ctx context.Context, c HealthChecker) error {
+	ctx, cancel := context.WithTimeout(ctx, hr.timeout)
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() { errc <- c.Check(ctx) }()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type healthResponse struct {
+	Status        string   `json:"status"`
+	Failed        []string `json:"failed,omitempty"`
+	StartedAt     string   `json:"started_at,omitempty"`
+	UptimeSeconds float64  `json:"uptime_seconds,omitempty"`
+}
+
+// withUptime returns resp with the process start time and uptime filled in.
+func withUptime(resp healthResponse) healthResponse {
+	resp.StartedAt = startTime.UTC().Format(time.RFC3339)
+	resp.UptimeSeconds = time.Since(startTime).Seconds()
+	return resp
+}
+
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	if shuttingDown.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, withUptime(healthResponse{Status: "shutting down"}))
+		return
+	}
+	writeJSON(w, http.StatusOK, withUptime(healthResponse{Status: "healthy"}))
+}
+
+// handleLive is the liveness probe: it succeeds whenever the process can
+// serve HTTP at all.
+func handleLive(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, withUptime(healthResponse{Status: "alive"}))
+}
+
+// markReadyAfter reports ready once delay has passed, or straight away if
+// delay is zero. A warm-up that ends after shutdown has started leaves the
+// server not ready.
+func markReadyAfter(delay time.Duration) {
+	if delay <= 0 {
+		ready.Store(true)
+		return
+	}
+	slog.Info("Warming up before reporting ready", "delay", delay.String())
+	time.AfterFunc(delay, func() {
+		if !shuttingDown.Load() {
+			ready.Store(true)
+			slog.Info("Warm-up finished, reporting ready")
+		}
+	})
+}
+
+// handleReady is the readiness probe: it fails until startup has finished,
+// while any registered dependency check is failing, and again once graceful
+// shutdown has started.
+func handleReady(w http.ResponseWriter, r *http.Request) {
+	if shuttingDown.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, healthResponse{Status: "shutting down"})
+		return
+	}
+	if !ready.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, healthResponse{Status: "not ready"})
+		return
+	}
+	if failed := healthChecks.Run(r.Context()); len(failed) > 0 {
+		writeJSON(w, http.StatusServiceUnavailable, healthResponse{Status: "not ready", Failed: failed})
+		return
+	}
+	writeJSON(w, http.StatusOK, healthResponse{Status: "ready"})
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// setFlag sets b to v for the rest of the test.
+func setFlag(t *testing.T, b *atomic.Bool, v bool) {
+	t.Helper()
+	old := b.Load()
+	b.Store(v)
+	t.Cleanup(func() { b.Store(old) })
+}
+
+func TestReadyzBeforeReady(t *testing.T) {
+	setFlag(t, &ready, false)
+	setFlag(t, &shuttingDown, false)
+
+	if rec := serve(http.HandlerFunc(handleReady), http.MethodGet, "/readyz"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz before ready: status %d, want 503", rec.Code)
+	}
+	if rec := serve(http.HandlerFunc(handleLive), http.MethodGet, "/livez"); rec.Code != http.StatusOK {
+		t.Errorf("/livez before ready: status %d, want 200", rec.Code)
+	}
+
+	ready.Store(true)
+	if rec := serve(http.HandlerFunc(handleReady), http.MethodGet, "/readyz"); rec.Code != http.StatusOK {
+		t.Errorf("/readyz once ready: status %d, want 200", rec.Code)
+	}
+}
+
+func TestHealthResponseRoundTrip(t *testing.T) {
+	setFlag(t, &shuttingDown, false)
+	rec := serve(http.HandlerFunc(handleHealth), http.MethodGet, "/health")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+
+	var resp healthResponse
+	dec := json.NewDecoder(rec.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&resp); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body, err)
+	}
+	if resp.Status != "healthy" {
+		t.Errorf("status = %q, want healthy", resp.Status)
+	}
+	if _, err := time.Parse(time.RFC3339, resp.StartedAt); err != nil {
+		t.Errorf("started_at %q is not RFC 3339: %v", resp.StartedAt, err)
+	}
+}
+
+// useHealthChecks swaps in a fresh registry for the rest of the test.
+func useHealthChecks(t *testing.T) *healthRegistry {
+	t.Helper()
+	old := healthChecks
+	healthChecks = newHealthRegistry(time.Second)
+	t.Cleanup(func() { healthChecks = old })
+	return healthChecks
+}
+
+func TestReadyzReportsFailingChecks(t *testing.T) {
+	setFlag(t, &ready, true)
+	setFlag(t, &shuttingDown, false)
+	hr := useHealthChecks(t)
+	hr.Register("database", HealthCheckerFunc(func(context.Context) error { return nil }))
+	hr.Register("cache", HealthCheckerFunc(func(context.Context) error { return errors.New("connection refused") }))
+	hr.Register("queue", HealthCheckerFunc(func(ctx context.Context) error {
+		<-ctx.Done() // never answers by itself
+		return ctx.Err()
+	}))
+	hr.timeout = 50 * time.Millisecond
+
+	rec := serve(http.HandlerFunc(handleReady), http.MethodGet, "/readyz")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status %d, want 503", rec.Code)
+	}
+	var resp healthResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"cache", "queue"}; !slices.Equal(resp.Failed, want) {
+		t.Errorf("failed = %q, want %q", resp.Failed, want)
+	}
+}
+
+func TestHealthFailsOnceShuttingDown(t *testing.T) {
+	setFlag(t, &ready, true)
+	setFlag(t, &shuttingDown, false)
+	if rec := serve(http.HandlerFunc(handleHealth), http.MethodGet, "/health"); rec.Code != http.StatusOK {
+		t.Fatalf("before shutdown: status %d, want 200", rec.Code)
+	}
+
+	// What main does when a signal arrives, before the shutdown delay.
+	shuttingDown.Store(true)
+	for path, h := range map[string]http.HandlerFunc{"/health": handleHealth, "/readyz": handleReady} {
+		rec := serve(h, http.MethodGet, path)
+		var resp healthResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		if rec.Code != http.StatusServiceUnavailable || resp.Status != "shutting down" {
+			t.Errorf("%s while shutting down: %d %q, want 503 shutting down", path, rec.Code, resp.Status)
+		}
+	}
+	if rec := serve(http.HandlerFunc(handleLive), http.MethodGet, "/livez"); rec.Code != http.StatusOK {
+		t.Errorf("/livez while shutting down: status %d, want 200", rec.Code)
+	}
+}
+
+func TestUptimeIncreases(t *testing.T) {
+	uptime := func() float64 {
+		t.Helper()
+		var resp healthResponse
+		if err := json.Unmarshal(serve(http.HandlerFunc(handleLive), http.MethodGet, "/livez").Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.StartedAt != startTime.UTC().Format(time.RFC3339) {
+			t.Errorf("started_at = %q, want the process start time", resp.StartedAt)
+		}
+		return resp.UptimeSeconds
+	}
+
+	first := uptime()
+	time.Sleep(20 * time.Millisecond)
+	second := uptime()
+	if first < 0 {
+		t.Errorf("uptime_seconds = %v, want >= 0", first)
+	}
+	if second <= first {
+		t.Errorf("uptime_seconds went from %v to %v, want it to increase", first, second)
+	}
+}
+
+func TestReadyzAfterStartupDelay(t *testing.T) {
+	setFlag(t, &ready, false)
+	setFlag(t, &shuttingDown, false)
+	useHealthChecks(t)
+
+	markReadyAfter(50 * time.Millisecond)
+	if rec := serve(http.HandlerFunc(handleReady), http.MethodGet, "/readyz"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("during the delay: status %d, want 503", rec.Code)
+	}
+	if rec := serve(http.HandlerFunc(handleLive), http.MethodGet, "/livez"); rec.Code != http.StatusOK {
+		t.Errorf("/livez during the delay: status %d, want 200", rec.Code)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for serve(http.HandlerFunc(handleReady), http.MethodGet, "/readyz").Code != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatal("/readyz still failing well after the delay")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStartupDelayEndingDuringShutdown(t *testing.T) {
+	setFlag(t, &ready, false)
+	setFlag(t, &shuttingDown, false)
+
+	markReadyAfter(10 * time.Millisecond)
+	shuttingDown.Store(true)
+	time.Sleep(50 * time.Millisecond)
+	if ready.Load() {
+		t.Error("ready set after shutdown had started")
+	}
+}
+
+func TestHealthCheckCacheTTL(t *testing.T) {
+	hr := newHealthRegistry(time.Second)
+	now := time.Unix(1_700_000_000, 0)
+	hr.now = func() time.Time { return now }
+	hr.SetCacheTTL(10 * time.Second)
+
+	var calls atomic.Int32
+	var fail atomic.Bool
+	hr.Register("db", HealthCheckerFunc(func(context.Context) error {
+		calls.Add(1)
+		if fail.Load() {
+			return errors.New("down")
+		}
+		return nil
+	}))
+
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		if failed := hr.Run(ctx); len(failed) != 0 {
+			t.Fatalf("Run = %v, want no failures", failed)
+		}
+		now = now.Add(time.Second)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("check ran %d times within the TTL, want 1", n)
+	}
+
+	now = now.Add(10 * time.Second)
+	fail.Store(true)
+	hr.Run(ctx)
+	if failed := hr.Run(ctx); len(failed) != 1 {
+		t.Errorf("Run = %v, want db failing", failed)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("check ran %d times, want 3: once after the TTL expired and again since failures aren't cached", n)
+	}
+}
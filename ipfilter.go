@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// parseCIDRs parses a list of CIDR blocks such as "10.0.0.0/8". A bare IP
+// address is accepted as a single-address block.
+func parseCIDRs(specs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(specs))
+	for _, spec := range specs {
+		if !strings.Contains(spec, "/") {
+			ip := net.ParseIP(spec)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address or CIDR %q", spec)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP address or CIDR %q", spec)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// ipFilterMiddleware refuses requests with 403 Forbidden unless the client
+// IP is in one of the allow blocks and in none of the deny blocks; deny
+// wins when both match, and an empty allow list allows every address.
+// Requests whose client address can't be parsed, such as those arriving on
+// a unix: socket, are refused.
+func ipFilterMiddleware(allow, deny []*net.IPNet, trustProxy bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !ipAllowed(net.ParseIP(clientIP(r, trustProxy)), allow, deny) {
+				writeJSON(w, http.StatusForbidden, errorResponse{Error: "forbidden", Path: r.URL.Path})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ipAllowed(ip net.IP, allow, deny []*net.IPNet) bool {
+	if ip == nil || containsIP(deny, ip) {
+		return false
+	}
+	return len(allow) == 0 || containsIP(allow, ip)
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
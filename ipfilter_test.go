@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIPFilter(t *testing.T) {
+	allow, err := parseCIDRs([]string{"10.0.0.0/8", "2001:db8::/32", "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deny, err := parseCIDRs([]string{"10.1.0.0/16"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ipFilterMiddleware(allow, deny, false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, tc := range []struct {
+		remoteAddr string
+		want       int
+	}{
+		{"10.2.3.4:5000", http.StatusOK},
+		{"192.0.2.1:5000", http.StatusOK},
+		{"[2001:db8::1]:5000", http.StatusOK},
+		{"10.1.2.3:5000", http.StatusForbidden}, // in both; deny wins
+		{"192.0.2.2:5000", http.StatusForbidden},
+		{"not-an-address", http.StatusForbidden},
+		{"@", http.StatusForbidden}, // a unix: socket peer
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tc.remoteAddr
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("RemoteAddr %q: status %d, want %d", tc.remoteAddr, rec.Code, tc.want)
+		}
+	}
+}
+
+func TestParseCIDRsRejectsMalformed(t *testing.T) {
+	for _, spec := range []string{"10.0.0.0/33", "10.0.0", "example.com"} {
+		if _, err := parseCIDRs([]string{spec}); err == nil {
+			t.Errorf("parseCIDRs(%q) succeeded, want an error", spec)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// unixAddrPrefix marks a listen address as a Unix domain socket path, as in
+// "unix:/var/run/app.sock".
+const unixAddrPrefix = "unix:"
+
+const defaultSocketMode = "0660"
+
+// listen opens the server's listener: a Unix domain socket for "unix:"
+// addresses and TCP otherwise. The socket file is chmod-ed to socketMode
+// and is unlinked again when the listener is closed.
+func listen(addr string, socketMode os.FileMode) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, unixAddrPrefix)
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, socketMode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// removeStaleSocket deletes a socket file left behind by a previous run. It
+// refuses to touch anything that isn't a socket, or a socket that another
+// process is still accepting connections on.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use by another process", path)
+	}
+	return os.Remove(path)
+}
+
+// parseSocketMode parses an octal file mode such as "0660".
+func parseSocketMode(s string) (os.FileMode, error) {
+	n, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || n > 0o777 {
+		return 0, fmt.Errorf("invalid socket mode %q: want octal permission bits such as 0660", s)
+	}
+	return os.FileMode(n), nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// socketPath returns a path for a Unix socket in a fresh directory, short
+// enough for the sun_path limit.
+func socketPath(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "app.sock")
+}
+
+func TestListenUnixSocket(t *testing.T) {
+	setFlag(t, &shuttingDown, false)
+	path := socketPath(t)
+	ln, err := listen(unixAddrPrefix+path, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := http.NewServeMux()
+	m.HandleFunc("GET /health", handleHealth)
+	srv := &http.Server{Handler: m}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != 0o600 {
+		t.Errorf("socket mode = %v, want a socket with 0600", info.Mode())
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Get("http://unix/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body healthResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || resp.StatusCode != http.StatusOK || body.Status != "healthy" {
+		t.Errorf("GET /health over the socket: %d %+v (%v), want 200 healthy", resp.StatusCode, body, err)
+	}
+}
+
+func TestListenReplacesStaleSocket(t *testing.T) {
+	path := socketPath(t)
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Closing a unix listener normally unlinks its file; leave it behind as
+	// a crashed process would.
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := listen(unixAddrPrefix+path, 0o660)
+	if err != nil {
+		t.Fatalf("listen over a stale socket: %v", err)
+	}
+	defer ln.Close()
+
+	if _, err := listen(unixAddrPrefix+path, 0o660); err == nil {
+		t.Error("listen on a socket in use succeeded, want an error")
+	}
+
+	file := filepath.Join(filepath.Dir(path), "regular")
+	os.WriteFile(file, nil, 0o644)
+	if _, err := listen(unixAddrPrefix+file, 0o660); err == nil {
+		t.Error("listen over a regular file succeeded, want an error")
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// logLevel is the minimum level written by the default logger. It is a
+// LevelVar so the level can be changed while the server is running.
+var logLevel = new(slog.LevelVar)
+
+// setupLogging installs a JSON slog handler writing to stderr, filtered by
+// logLevel, as the default logger. The standard library log package is
+// routed through it as well.
+func setupLogging() {
+	slog.SetDefault(newLogger(os.Stderr))
+}
+
+// newLogger returns a JSON logger writing to w, filtered by logLevel.
+func newLogger(w io.Writer) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: logLevel}))
+}
+
+func parseLogLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q (want debug, info, warn or error)", s)
+}
+
+// applyLogLevel sets logLevel from c, which has already been validated.
+func applyLogLevel(c Config) {
+	lvl, _ := parseLogLevel(c.LogLevel)
+	logLevel.Set(lvl)
+}
+
+// fatal logs msg at error level and exits with status 1.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLogLevelFiltersLines(t *testing.T) {
+	defer logLevel.Set(logLevel.Level())
+	lvl, err := parseLogLevel("WARN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logLevel.Set(lvl)
+
+	var buf bytes.Buffer
+	logger := newLogger(&buf)
+	logger.Info("info line")
+	logger.Debug("debug line")
+	logger.Warn("warn line")
+	logger.Error("error line")
+
+	out := buf.String()
+	for _, suppressed := range []string{"info line", "debug line"} {
+		if strings.Contains(out, suppressed) {
+			t.Errorf("output contains %q at level warn", suppressed)
+		}
+	}
+	for _, kept := range []string{`"level":"WARN","msg":"warn line"`, `"level":"ERROR","msg":"error line"`} {
+		if !strings.Contains(out, kept) {
+			t.Errorf("output lacks %s:\n%s", kept, out)
+		}
+	}
+
+	// The level is read on every call, so changing it takes effect at once.
+	logLevel.Set(slog.LevelDebug)
+	logger.Debug("now visible")
+	if !strings.Contains(buf.String(), "now visible") {
+		t.Error("debug line suppressed after lowering the level")
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	for in, want := range map[string]slog.Level{"debug": slog.LevelDebug, " Info ": slog.LevelInfo, "warning": slog.LevelWarn, "ERROR": slog.LevelError} {
+		if got, err := parseLogLevel(in); err != nil || got != want {
+			t.Errorf("parseLogLevel(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if _, err := parseLogLevel("verbose"); err == nil {
+		t.Error("parseLogLevel(verbose) succeeded, want an error")
+	}
+}
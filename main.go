@@ -1,27 +1,388 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"runtime"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"text/template"
+	"time"
+)
+
+// Build metadata, set at build time with
+// -ldflags "-X main.version=... -X main.commit=... -X main.buildTime=...".
+var (
+	version   = "dev"
+	commit    = "dev"
+	buildTime = "dev"
+)
+
+// mux is the server's route table. It is deliberately not
+// http.DefaultServeMux, which imported packages such as net/http/pprof
+// register handlers on as a side effect.
+var mux = http.NewServeMux()
+
+// startTime is when the process started, reported by the health endpoints.
+var startTime = time.Now()
+
+// hostname is resolved once at startup; it does not change for the
+// lifetime of the process.
+var hostname = "unknown"
+
+const (
+	defaultAddr         = ":8080"
+	defaultDrainTimeout = 15 * time.Second
+
+	// defaultShutdownDelay gives load balancers time to notice the failing
+	// health checks and stop sending traffic before the listener closes.
+	defaultShutdownDelay = 5 * time.Second
+
+	// Server timeouts guard against slow clients holding connections open
+	// (Slowloris). Each can be overridden by flag, environment variable or
+	// config file.
+	defaultReadHeaderTimeout = 5 * time.Second  // -read-header-timeout, $READ_HEADER_TIMEOUT
+	defaultReadTimeout       = 15 * time.Second // -read-timeout, $READ_TIMEOUT
+	defaultWriteTimeout      = 15 * time.Second // -write-timeout, $WRITE_TIMEOUT
+	defaultIdleTimeout       = 60 * time.Second // -idle-timeout, $IDLE_TIMEOUT
 )
 
 func main() {
-	http.HandleFunc("/", handleRoot)
-	http.HandleFunc("/health", handleHealth)
+	setupLogging()
+
+	cfg, checkOnly, err := loadConfig(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fatal("Invalid configuration", "error", err)
+	}
+	if checkOnly {
+		if err := cfg.check(); err != nil {
+			fatal("Invalid configuration", "error", err)
+		}
+		slog.Info("Configuration OK", "config", cfg)
+		return
+	}
+	applyLogLevel(cfg)
+	slog.Info("Configuration loaded", "config", cfg)
+	useTLS := cfg.TLSCert != ""
+
+	if h, err := os.Hostname(); err != nil {
+		slog.Warn("Could not determine hostname", "error", err)
+	} else {
+		hostname = h
+	}
+
+	healthChecks.SetCacheTTL(cfg.HealthCacheTTL)
+
+	// Settings that SIGHUP can change while the server runs. Everything
+	// else is fixed at startup.
+	var requestTimeout atomic.Int64
+	requestTimeout.Store(int64(cfg.RequestTimeout))
+	// The timeout middleware and the reverse proxy read the request timeout
+	// per request, so a reload applies to both.
+	currentRequestTimeout := func() time.Duration { return time.Duration(requestTimeout.Load()) }
+	limiter := newRateLimiter(cfg.RateLimit, cfg.RateBurst, cfg.TrustProxy)
+	setRateLimits := func(c Config) { limiter.setLimits(c.RateLimit, c.RateBurst) }
+	reload := newReloader(cfg, map[string]func(Config){
+		"log_level":        applyLogLevel,
+		"rate_limit":       setRateLimits,
+		"rate_burst":       setRateLimits,
+		"request_timeout":  func(c Config) { requestTimeout.Store(int64(c.RequestTimeout)) },
+		"health_cache_ttl": func(c Config) { healthChecks.SetCacheTTL(c.HealthCacheTTL) },
+	})
+
+	// The IP filter guards the routes in ip_filter_paths, or every request
+	// when that is empty.
+	var ipFilter func(http.Handler) http.Handler
+	if len(cfg.IPAllow) > 0 || len(cfg.IPDeny) > 0 {
+		allow, _ := parseCIDRs(cfg.IPAllow)
+		deny, _ := parseCIDRs(cfg.IPDeny)
+		ipFilter = ipFilterMiddleware(allow, deny, cfg.TrustProxy)
+	}
+
+	// handle registers a route and records it for /admin/routes, wrapping
+	// it in basic auth if its path is listed in basic_auth_paths and in the
+	// IP filter if it is listed in ip_filter_paths.
+	routes := &routeTable{}
+	basicAuth := basicAuthMiddleware(cfg.BasicAuthUser, cfg.BasicAuthPassword)
+	handle := func(pattern, description string, h http.Handler) {
+		if slices.Contains(cfg.BasicAuthPaths, patternPath(pattern)) {
+			h = basicAuth(h)
+		}
+		if ipFilter != nil && slices.Contains(cfg.IPFilterPaths, patternPath(pattern)) {
+			h = ipFilter(h)
+		}
+		mux.Handle(pattern, h)
+		routes.add(pattern, description)
+	}
+
+	// GET patterns also match HEAD. Anything unmatched gets a JSON 404, or a
+	// 405 with an Allow header if the path exists for other methods.
+	handle("GET /{$}", "greeting as text or JSON", handleRoot(cfg.greeting))
+	handle("GET /health", "health check, failing during shutdown", http.HandlerFunc(handleHealth))
+	handle("GET /livez", "liveness probe", http.HandlerFunc(handleLive))
+	handle("GET /readyz", "readiness probe, including dependency checks", http.HandlerFunc(handleReady))
+	handle("GET "+metricsPath, "Prometheus metrics", httpMetrics)
+	handle("GET /version", "build version information", http.HandlerFunc(handleVersion))
+	handle("/echo", "reflects the request back as JSON", handleEcho(cfg.EchoMaxBody))
+	wsEcho := newWSEcho(cfg.EchoMaxBody)
+	handle("GET "+wsPath, "WebSocket echo", wsEcho)
+	if cfg.StaticDir != "" {
+		handle("GET "+staticPrefix, "static files from "+cfg.StaticDir, staticHandler(cfg.StaticDir))
+	}
+	// Proxied responses are streamed, so like the other streaming routes
+	// they are exempt from the request timeout; the proxy bounds the wait
+	// for upstream headers itself.
+	timeoutExempt := []string{metricsPath, pprofPrefix, wsPath}
+	proxyRoutes, _ := parseProxyRoutes(cfg.ProxyRoutes)
+	for _, pr := range proxyRoutes {
+		handle(pr.prefix, "reverse proxy to "+pr.upstream.Redacted(), newProxy(pr.upstream, currentRequestTimeout, cfg.TrustProxy))
+		timeoutExempt = append(timeoutExempt, pr.prefix)
+	}
+	if cfg.EnablePprof {
+		registerPprof(handle, cfg.PprofToken)
+	}
+
+	// Admin endpoints are only served when $ADMIN_TOKEN is set, and require
+	// it as a bearer token.
+	shutdownRequests := make(chan struct{}, 1)
+	if cfg.AdminToken != "" {
+		adminAuth := bearerAuthMiddleware(cfg.AdminToken)
+		handle("POST /admin/shutdown", "graceful shutdown", adminAuth(handleShutdown(shutdownRequests)))
+		handle("GET /admin/config", "active configuration, secrets redacted", adminAuth(handleConfig(reload.current)))
+		handle("GET /admin/routes", "this list of routes", adminAuth(routes))
+	}
+
+	// Middleware is listed innermost first.
+	handler := withJSONErrors(mux)
+	handler = recoverMiddleware(handler)
+	handler = timeoutMiddleware(currentRequestTimeout, timeoutExempt...)(handler)
+	handler = maxBodyMiddleware(cfg.MaxBodySize)(handler)
+	handler = gzipMiddleware(handler)
+	if cfg.MaxConcurrent > 0 {
+		handler = concurrencyLimitMiddleware(cfg.MaxConcurrent)(handler)
+	}
+	handler = rateLimitMiddleware(limiter)(handler)
+	if len(cfg.CORSOrigins) > 0 {
+		handler = corsMiddleware(cfg.CORSOrigins)(handler)
+	}
+	if ipFilter != nil && len(cfg.IPFilterPaths) == 0 {
+		handler = ipFilter(handler)
+	}
+	handler = securityHeadersMiddleware(cfg.HSTSMaxAge)(handler)
+	handler = loggingMiddleware(cfg.AccessLogFormat, os.Stdout, cfg.TrustProxy)(handler)
+	if cfg.DebugDump {
+		handler = debugDumpMiddleware(debugDumpMaxBody)(handler)
+	}
+	tp, shutdownTracing, err := newTracerProvider(cfg.OTLPEndpoint, cfg.ServiceName)
+	if err != nil {
+		fatal("Failed to set up tracing", "error", err)
+	}
+	handler = tracingMiddleware(tp)(handler)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Warn("Failed to flush traces", "error", err)
+		}
+	}()
+	handler = requestIDMiddleware(handler)
+
+	var conns connCounter
+	server := newServer(cfg, handler, conns.track)
+	server.RegisterOnShutdown(wsEcho.shutdown)
+	if useTLS {
+		server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	socketMode, _ := parseSocketMode(cfg.SocketMode)
+	ln, err := listen(cfg.Addr, socketMode)
+	if err != nil {
+		fatal("Could not listen", "addr", cfg.Addr, "error", err)
+	}
+	if cfg.ProxyProtocol {
+		ln = newProxyProtoListener(ln, cfg.ReadHeaderTimeout)
+	}
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	// SIGHUP re-reads the configuration, keeping flags given at startup,
+	// and applies what can change without a restart. In-flight requests
+	// and open connections are unaffected.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			next, _, err := loadConfig(os.Args[1:], os.Getenv)
+			if err != nil {
+				slog.Error("Reload failed, keeping current configuration", "error", err)
+				continue
+			}
+			reload.apply(next)
+		}
+	}()
+
+	// Liveness is unaffected by the warm-up: /livez succeeds throughout.
+	markReadyAfter(cfg.StartupDelay)
+
+	servers := serverGroup{server}
+	serveErr := make(chan error, 2)
+	if cfg.RedirectAddr != "" {
+		redirectServer := newServer(cfg, httpsRedirectHandler(cfg.Addr), conns.track)
+		redirectLn, err := listen(cfg.RedirectAddr, socketMode)
+		if err != nil {
+			fatal("Could not listen", "addr", cfg.RedirectAddr, "error", err)
+		}
+		if cfg.ProxyProtocol {
+			// The balancer fronts both ports, so both speak PROXY.
+			redirectLn = newProxyProtoListener(redirectLn, cfg.ReadHeaderTimeout)
+		}
+		servers = append(servers, redirectServer)
+		go func() {
+			slog.Info("Redirect server starting", "addr", cfg.RedirectAddr, "mode", "http")
+			serveErr <- redirectServer.Serve(redirectLn)
+		}()
+	}
+	go func() {
+		if useTLS {
+			slog.Info("Server starting", "addr", cfg.Addr, "mode", "https")
+			serveErr <- server.ServeTLS(ln, cfg.TLSCert, cfg.TLSKey)
+			return
+		}
+		slog.Info("Server starting", "addr", cfg.Addr, "mode", "http")
+		serveErr <- server.Serve(ln)
+	}()
+
+	signalled := false
+	select {
+	case err := <-serveErr:
+		fatal("Server failed", "error", err)
+	case sig := <-signals:
+		slog.Info("Signal received, shutting down gracefully (signal again to force)", "signal", sig.String())
+		signalled = true
+	case <-shutdownRequests:
+	}
+	shuttingDown.Store(true)
+	ready.Store(false)
+
+	force := forceOnSignal(signals, signalled)
+	sm := &shutdownManager{
+		server:       servers,
+		delay:        cfg.ShutdownDelay,
+		drainTimeout: cfg.DrainTimeout,
+		openConns:    conns.open,
+	}
+	sm.run(force)
+	wsEcho.wait(wsCloseTimeout)
+}
+
+// newServer returns a server for h with the configured connection
+// timeouts, reporting connection state changes to connState.
+func newServer(cfg Config, h http.Handler, connState func(net.Conn, http.ConnState)) *http.Server {
+	return &http.Server{
+		Handler:           h,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		ConnState:         connState,
+	}
+}
+
+type rootResponse struct {
+	Message  string `json:"message"`
+	Hostname string `json:"hostname"`
+	Path     string `json:"path"`
+}
+
+// handleRoot serves the greeting rendered from tmpl as the plain-text body
+// or, for clients that ask for it in Accept, as the message of a JSON body.
+// The response carries a weak ETag derived from the body, so polling
+// clients can revalidate with If-None-Match and get a 304 instead of the
+// same bytes again.
+func handleRoot(tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var msg strings.Builder
+		if err := tmpl.Execute(&msg, greetingData{Hostname: hostname, Path: r.URL.Path}); err != nil {
+			slog.Error("Failed to render greeting", "request_id", requestIDFromContext(r.Context()), "error", err)
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "internal server error", Path: r.URL.Path})
+			return
+		}
+		serveGreeting(w, r, msg.String())
+	}
+}
+
+func serveGreeting(w http.ResponseWriter, r *http.Request, greeting string) {
+	w.Header().Add("Vary", "Accept")
+	var body []byte
+	switch negotiateContentType(r.Header.Get("Accept"), "text/plain", "application/json") {
+	case "text/plain":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		body = fmt.Appendf(nil, "%s\nHostname: %s\nPath: %s\n", greeting, hostname, r.URL.Path)
+	case "application/json":
+		w.Header().Set("Content-Type", "application/json")
+		body, _ = json.Marshal(rootResponse{Message: greeting, Hostname: hostname, Path: r.URL.Path})
+		body = append(body, '\n')
+	default:
+		writeJSON(w, http.StatusNotAcceptable, errorResponse{Error: "not acceptable: supported types are text/plain and application/json", Path: r.URL.Path})
+		return
+	}
+
+	etag := weakETag(body)
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.Header().Del("Content-Type")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Write(body)
+}
+
+type versionResponse struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"buildTime"`
+	GoVersion string `json:"goVersion"`
+}
+
+func handleVersion(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, versionResponse{
+		Version:   version,
+		Commit:    commit,
+		BuildTime: buildTime,
+		GoVersion: runtime.Version(),
+	})
+}
 
-	port := ":8080"
-	log.Printf("Server starting on port %s", port)
-	log.Fatal(http.ListenAndServe(port, nil))
+func handleNotFound(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusNotFound, errorResponse{Error: "not found", Path: r.URL.Path})
 }
 
-func handleRoot(w http.ResponseWriter, r *http.Request) {
-	hostname, _ := os.Hostname()
-	fmt.Fprintf(w, "Hello from 1st-repo!\nHostname: %s\nPath: %s\n", hostname, r.URL.Path)
+// errorResponse is the JSON body returned for failed requests.
+type errorResponse struct {
+	Error string `json:"error"`
+	Path  string `json:"path,omitempty"`
 }
 
-func handleHealth(w http.ResponseWriter, r *http.Request) {
+// writeJSON encodes v as the response body with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v any) {
 	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, `{"status":"healthy"}`)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode JSON response", "error", err)
+	}
 }
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// runMainEnv, when set, makes the test binary run main with the
+// arguments that follow instead of running tests; see runMain.
+const runMainEnv = "TEST_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) == "1" {
+		main()
+		os.Exit(0)
+	}
+	// Handlers log failures they are being tested for; keep that out of
+	// the test output.
+	slog.SetDefault(slog.New(slog.NewJSONHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+var (
+	testRoutesMu sync.Mutex
+	testRoutes   = make(map[string]bool)
+)
+
+// registerTestRoute adds pattern to the package mux, as main does, so that
+// route labels resolve in tests. Registering the same pattern again is a
+// no-op, letting several tests share a route.
+func registerTestRoute(pattern string, h http.Handler) {
+	testRoutesMu.Lock()
+	defer testRoutesMu.Unlock()
+	if testRoutes[pattern] {
+		return
+	}
+	testRoutes[pattern] = true
+	mux.Handle(pattern, h)
+}
+
+// runMain runs main in a child process with args and an empty
+// environment, returning its combined output and exit code.
+func runMain(t *testing.T, args ...string) (string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = []string{runMainEnv + "=1"}
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return string(out), exitErr.ExitCode()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out), 0
+}
+
+func noEnv(string) string { return "" }
+
+// mustLoadConfig loads a configuration from args alone, ignoring the
+// process environment.
+func mustLoadConfig(t *testing.T, args ...string) Config {
+	t.Helper()
+	cfg, _, err := loadConfig(args, noEnv)
+	if err != nil {
+		t.Fatalf("loadConfig(%q): %v", args, err)
+	}
+	return cfg
+}
+
+// serve runs a request for method and target through h and returns the
+// recorded response.
+func serve(h http.Handler, method, target string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+	return rec
+}
+
+func TestServerCutsOffSlowHeaders(t *testing.T) {
+	cfg := mustLoadConfig(t, "-read-header-timeout", "100ms")
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newServer(cfg, http.NotFoundHandler(), nil)
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// Start a request but never finish the header block.
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: test\r\n")
+
+	start := time.Now()
+	conn.SetReadDeadline(start.Add(5 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	if err != io.EOF {
+		t.Fatalf("read = %v, want the server to close the connection", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("connection closed after %v, want about the 100ms header timeout", elapsed)
+	}
+}
+
+func getRootWithHeader(t *testing.T, name, value string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if value != "" {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	handleRoot(mustLoadConfig(t).greeting).ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRootContentNegotiation(t *testing.T) {
+	for _, accept := range []string{"", "*/*", "text/plain", "text/html;q=0.9, text/plain"} {
+		rec := getRootWithHeader(t, "Accept", accept)
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/plain; charset=utf-8" {
+			t.Errorf("Accept %q: %d %q, want 200 text/plain", accept, rec.Code, rec.Header().Get("Content-Type"))
+		}
+		if !strings.HasPrefix(rec.Body.String(), "Hello from 1st-repo!\n") {
+			t.Errorf("Accept %q: body %q, want the text greeting", accept, rec.Body)
+		}
+	}
+
+	rec := getRootWithHeader(t, "Accept", "application/json")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("Accept application/json: %d %q, want 200 application/json", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var resp rootResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	want := rootResponse{Message: "Hello from 1st-repo!", Hostname: hostname, Path: "/"}
+	if resp != want {
+		t.Errorf("JSON body = %+v, want %+v", resp, want)
+	}
+
+	rec = getRootWithHeader(t, "Accept", "image/png")
+	if rec.Code != http.StatusNotAcceptable {
+		t.Errorf("Accept image/png: status %d, want 406", rec.Code)
+	}
+	if got := rec.Header().Get("Vary"); got != "Accept" {
+		t.Errorf("Vary = %q, want Accept", got)
+	}
+}
+
+func TestRootConditionalGet(t *testing.T) {
+	rec := getRootWithHeader(t, "If-None-Match", "")
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("first request: %d with ETag %q, want 200 with a weak ETag", rec.Code, etag)
+	}
+
+	for _, inm := range []string{etag, strings.TrimPrefix(etag, "W/"), `"other", ` + etag, "*"} {
+		rec = getRootWithHeader(t, "If-None-Match", inm)
+		if rec.Code != http.StatusNotModified {
+			t.Errorf("If-None-Match %s: status %d, want 304", inm, rec.Code)
+		}
+		if rec.Body.Len() != 0 {
+			t.Errorf("If-None-Match %s: body %q, want empty", inm, rec.Body)
+		}
+		if got := rec.Header().Get("ETag"); got != etag {
+			t.Errorf("If-None-Match %s: ETag %q, want %q", inm, got, etag)
+		}
+	}
+
+	if rec = getRootWithHeader(t, "If-None-Match", `W/"stale"`); rec.Code != http.StatusOK {
+		t.Errorf("stale If-None-Match: status %d, want 200", rec.Code)
+	}
+}
+
+func TestCheckFlag(t *testing.T) {
+	out, code := runMain(t, "-check", "-addr", "127.0.0.1:0")
+	if code != 0 || !strings.Contains(out, "Configuration OK") {
+		t.Errorf("-check with a valid config: exit %d, output %s", code, out)
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing.pem")
+	out, code = runMain(t, "-check", "-tls-cert", missing, "-tls-key", missing)
+	if code == 0 {
+		t.Errorf("-check with a missing TLS certificate exited 0: %s", out)
+	}
+	if !strings.Contains(out, "Invalid configuration") || !strings.Contains(out, "tls_cert/tls_key") {
+		t.Errorf("-check with a missing TLS certificate: output %s, want the tls_cert/tls_key error", out)
+	}
+}
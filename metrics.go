@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metricsPath is where the Prometheus exposition is served. Scrapes of it
+// are not counted so they don't dominate the request metrics.
+const metricsPath = "/metrics"
+
+// durationBuckets are the upper bounds, in seconds, of the request duration
+// histogram. They match the Prometheus client library defaults.
+var durationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// httpMetrics collects request metrics for the whole process.
+var httpMetrics = newMetrics()
+
+type requestKey struct {
+	path string
+	code int
+}
+
+type histogram struct {
+	buckets []uint64 // cumulative counts, parallel to durationBuckets
+	sum     float64
+	count   uint64
+}
+
+// summary is a Prometheus summary without quantiles: a running sum and
+// count, from which the average can be derived.
+type summary struct {
+	sum   uint64
+	count uint64
+}
+
+// metrics is a minimal Prometheus-compatible collector for request counts,
+// durations and response sizes, rendered in the text exposition format.
+type metrics struct {
+	mu        sync.Mutex
+	requests  map[requestKey]uint64
+	durations map[string]*histogram
+	sizes     map[string]*summary
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests:  make(map[requestKey]uint64),
+		durations: make(map[string]*histogram),
+		sizes:     make(map[string]*summary),
+	}
+}
+
+// observe records a completed request under the given route label, with
+// the number of response body bytes written.
+func (m *metrics) observe(path string, code int, d time.Duration, bytes int64) {
+	if path == metricsPath {
+		return
+	}
+	secs := d.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[requestKey{path, code}]++
+	h := m.durations[path]
+	if h == nil {
+		h = &histogram{buckets: make([]uint64, len(durationBuckets))}
+		m.durations[path] = h
+	}
+	for i, le := range durationBuckets {
+		if secs <= le {
+			h.buckets[i]++
+		}
+	}
+	h.sum += secs
+	h.count++
+
+	s := m.sizes[path]
+	if s == nil {
+		s = &summary{}
+		m.sizes[path] = s
+	}
+	s.sum += uint64(bytes)
+	s.count++
+}
+
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("# HELP http_requests_total Total HTTP requests by path and status code.\n")
+	b.WriteString("# TYPE http_requests_total counter\n")
+	keys := make([]requestKey, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].path != keys[j].path {
+			return keys[i].path < keys[j].path
+		}
+		return keys[i].code < keys[j].code
+	})
+	for _, k := range keys {
+		fmt.Fprintf(&b, "http_requests_total{path=%s,code=\"%d\"} %d\n", labelValue(k.path), k.code, m.requests[k])
+	}
+
+	b.WriteString("# HELP http_request_duration_seconds HTTP request latency by path.\n")
+	b.WriteString("# TYPE http_request_duration_seconds histogram\n")
+	paths := make([]string, 0, len(m.durations))
+	for p := range m.durations {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		h := m.durations[p]
+		lv := labelValue(p)
+		for i, le := range durationBuckets {
+			fmt.Fprintf(&b, "http_request_duration_seconds_bucket{path=%s,le=\"%s\"} %d\n", lv, formatFloat(le), h.buckets[i])
+		}
+		fmt.Fprintf(&b, "http_request_duration_seconds_bucket{path=%s,le=\"+Inf\"} %d\n", lv, h.count)
+		fmt.Fprintf(&b, "http_request_duration_seconds_sum{path=%s} %s\n", lv, formatFloat(h.sum))
+		fmt.Fprintf(&b, "http_request_duration_seconds_count{path=%s} %d\n", lv, h.count)
+	}
+
+	b.WriteString("# HELP http_response_size_bytes HTTP response body size by path.\n")
+	b.WriteString("# TYPE http_response_size_bytes summary\n")
+	for _, p := range paths {
+		s := m.sizes[p]
+		lv := labelValue(p)
+		fmt.Fprintf(&b, "http_response_size_bytes_sum{path=%s} %d\n", lv, s.sum)
+		fmt.Fprintf(&b, "http_response_size_bytes_count{path=%s} %d\n", lv, s.count)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
+
+// routeLabel returns the registered pattern that serves r, so that metric
+// cardinality is bounded by the route table rather than by client paths.
+func routeLabel(r *http.Request) string {
+	_, pattern := mux.Handler(r)
+	if pattern == "" {
+		return "unmatched"
+	}
+	return patternPath(pattern)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func labelValue(s string) string {
+	return `"` + labelEscaper.Replace(s) + `"`
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// responseWriter wraps an http.ResponseWriter to record the status code and
+// the total number of body bytes written by the handler across all of its
+// Write calls.
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	return &responseWriter{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	if !rw.wroteHeader {
+		rw.status = code
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+// Hijack hands the connection over to the handler, as for a WebSocket
+// upgrade, recording the request as 101 Switching Protocols.
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(rw.ResponseWriter).Hijack()
+	if err == nil {
+		rw.status = http.StatusSwitchingProtocols
+		rw.wroteHeader = true
+	}
+	return conn, brw, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Access log formats accepted by -access-log-format.
+const (
+	accessLogJSON = "json"
+	accessLogCLF  = "clf"
+)
+
+// loggingMiddleware emits one access log line per request and records the
+// request's status, latency and response size in httpMetrics. In the json
+// format the line goes through slog with the request's method, path,
+// status, response size and latency; in the clf format a Combined Log
+// Format line is written to out instead, with the remote host taken from
+// X-Forwarded-For when trustProxy is set.
+func loggingMiddleware(format string, out io.Writer, trustProxy bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rw := newResponseWriter(w)
+			next.ServeHTTP(rw, r)
+			elapsed := time.Since(start)
+			httpMetrics.observe(routeLabel(r), rw.status, elapsed, rw.bytes)
+			if format == accessLogCLF {
+				out.Write(combinedLogLine(r, clientIP(r, trustProxy), start, rw.status, rw.bytes))
+				return
+			}
+			slog.Info("request",
+				"request_id", requestIDFromContext(r.Context()),
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", rw.status,
+				"bytes", rw.bytes,
+				"duration_ms", float64(elapsed.Microseconds())/1000,
+			)
+		})
+	}
+}
+
+// combinedLogLine formats a request in Combined Log Format:
+//
+//	host - - [10/Oct/2000:13:55:36 -0700] "GET /path HTTP/1.1" 200 2326 "referer" "user-agent"
+func combinedLogLine(r *http.Request, host string, start time.Time, status int, bytes int64) []byte {
+	size := "-"
+	if bytes > 0 {
+		size = strconv.FormatInt(bytes, 10)
+	}
+	return fmt.Appendf(nil, "%s - - [%s] %s %d %s %s %s\n",
+		host,
+		start.Format("02/Jan/2006:15:04:05 -0700"),
+		clfQuote(r.Method+" "+r.RequestURI+" "+r.Proto),
+		status,
+		size,
+		clfQuote(r.Referer()),
+		clfQuote(r.UserAgent()),
+	)
+}
+
+// clfQuote quotes a request-controlled field so it can't break the line
+// apart, using "-" for empty values as log parsers expect.
+func clfQuote(s string) string {
+	if s == "" {
+		return `"-"`
+	}
+	return strconv.Quote(s)
+}
+
+// recoverMiddleware turns a panicking handler into a 500 response instead of
+// a dropped connection, logging the panic value and stack trace.
+func recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+			slog.Error("panic serving request",
+				"request_id", requestIDFromContext(r.Context()),
+				"method", r.Method,
+				"path", r.URL.Path,
+				"panic", fmt.Sprint(err),
+				"stack", string(debug.Stack()),
+			)
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "internal server error"})
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+const requestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// requestIDMiddleware makes sure every request carries a correlation ID. An
+// inbound X-Request-ID is kept if it looks sane, otherwise a new one is
+// generated. The ID is stored in the request context and echoed back in the
+// response header.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestIDFromContext returns the request ID stored by requestIDMiddleware,
+// or "" if there is none.
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		slog.Error("Failed to generate request ID", "error", err)
+		return "unknown"
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// validRequestID accepts client-supplied IDs of reasonable length made of
+// printable ASCII, so they are safe to put in logs and headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+const defaultHSTSMaxAge = 365 * 24 * time.Hour
+
+// securityHeadersMiddleware sets standard hardening headers on every
+// response. Strict-Transport-Security is only sent over TLS, since browsers
+// ignore it on plain HTTP and caching it there would be misleading; a
+// non-positive hstsMaxAge disables it.
+func securityHeadersMiddleware(hstsMaxAge time.Duration) func(http.Handler) http.Handler {
+	hsts := "max-age=" + strconv.FormatInt(int64(hstsMaxAge.Seconds()), 10)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Set("X-Content-Type-Options", "nosniff")
+			h.Set("X-Frame-Options", "DENY")
+			h.Set("Referrer-Policy", "no-referrer")
+			if r.TLS != nil && hstsMaxAge > 0 {
+				h.Set("Strict-Transport-Security", hsts)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP returns the address of the client that made r. When trustProxy is
+// set and the request came through a proxy, the last valid address in
+// X-Forwarded-For is used: that is the one appended by our own proxy, while
+// earlier entries are supplied by the client and can be forged.
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			if ip := net.ParseIP(strings.TrimSpace(hops[i])); ip != nil {
+				return ip.String()
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+const defaultMaxBodySize = 1 << 20
+
+// maxBodyMiddleware caps request bodies at limit bytes. Requests that
+// declare a larger Content-Length are refused with 413 up front; otherwise
+// the body is wrapped in http.MaxBytesReader so handlers reading past the
+// limit get an *http.MaxBytesError, which they should report as 413.
+func maxBodyMiddleware(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				w.Header().Set("Connection", "close")
+				writeJSON(w, http.StatusRequestEntityTooLarge, errorResponse{Error: "request body too large"})
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// concurrencyRetryAfter is the Retry-After hint, in seconds, sent with 503s
+// from concurrencyLimitMiddleware. Slots free up as soon as any in-flight
+// request finishes, so a short retry is appropriate.
+const concurrencyRetryAfter = "1"
+
+// concurrencyLimitMiddleware allows at most max requests to be in flight at
+// once. Requests arriving while every slot is taken are rejected straight
+// away with 503 and a Retry-After header rather than queued.
+func concurrencyLimitMiddleware(max int) func(http.Handler) http.Handler {
+	slots := make(chan struct{}, max)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case slots <- struct{}{}:
+			default:
+				w.Header().Set("Retry-After", concurrencyRetryAfter)
+				writeJSON(w, http.StatusServiceUnavailable, errorResponse{Error: "server busy"})
+				return
+			}
+			defer func() { <-slots }()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestResponseWriterCountsBytes(t *testing.T) {
+	chunks := []string{"hello", ", ", strings.Repeat("x", 4096), "\n"}
+	want := 0
+	for _, c := range chunks {
+		want += len(c)
+	}
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, c := range chunks {
+			io.WriteString(w, c)
+		}
+	})
+
+	var out bytes.Buffer
+	rec := httptest.NewRecorder()
+	loggingMiddleware(accessLogCLF, &out, false)(h).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/sized", nil))
+	if rec.Body.Len() != want {
+		t.Fatalf("client got %d bytes, want %d", rec.Body.Len(), want)
+	}
+	if fields := strings.Fields(out.String()); len(fields) < 10 || fields[9] != strconv.Itoa(want) {
+		t.Errorf("access log line %q does not record %d bytes", out.String(), want)
+	}
+
+	m := newMetrics()
+	m.observe("/sized", http.StatusOK, time.Millisecond, int64(want))
+	m.observe("/sized", http.StatusOK, time.Millisecond, 6)
+	rec = httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metricsPath, nil))
+	for _, line := range []string{
+		`http_response_size_bytes_sum{path="/sized"} 4110`,
+		`http_response_size_bytes_count{path="/sized"} 2`,
+	} {
+		if !strings.Contains(rec.Body.String(), line+"\n") {
+			t.Errorf("metrics output lacks %q", line)
+		}
+	}
+}
+
+func TestRecoverMiddlewareReturns500AndKeepsServing(t *testing.T) {
+	srv := httptest.NewServer(recoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/panic" {
+			panic("boom")
+		}
+		io.WriteString(w, "ok")
+	})))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/panic")
+	if err != nil {
+		t.Fatalf("GET /panic: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("GET /panic: status %d, want 500", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("GET /panic: Content-Type %q, want application/json", got)
+	}
+	if !strings.Contains(string(body), `"internal server error"`) || strings.Contains(string(body), "boom") {
+		t.Errorf("GET /panic: body %q, want a generic JSON error", body)
+	}
+
+	resp, err = http.Get(srv.URL + "/ok")
+	if err != nil {
+		t.Fatalf("GET /ok after a panic: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /ok after a panic: status %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestRequestIDPreservedOrGenerated(t *testing.T) {
+	var seen string
+	h := requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestIDFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(requestIDHeader, "upstream-id-123")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if seen != "upstream-id-123" || rec.Header().Get(requestIDHeader) != "upstream-id-123" {
+		t.Errorf("inbound ID: context %q, header %q, want both upstream-id-123", seen, rec.Header().Get(requestIDHeader))
+	}
+
+	for _, inbound := range []string{"", "bad id\x7f", strings.Repeat("a", 129)} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if inbound != "" {
+			req.Header.Set(requestIDHeader, inbound)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		got := rec.Header().Get(requestIDHeader)
+		if len(got) != 32 || got == inbound || seen != got {
+			t.Errorf("inbound %q: got ID %q (context %q), want a fresh 32-digit hex ID", inbound, got, seen)
+		}
+	}
+}
+
+func TestSecurityHeadersOnRoot(t *testing.T) {
+	h := securityHeadersMiddleware(defaultHSTSMaxAge)(handleRoot(mustLoadConfig(t).greeting))
+
+	rec := serve(h, http.MethodGet, "/")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", rec.Code)
+	}
+	for name, want := range map[string]string{
+		"X-Content-Type-Options": "nosniff",
+		"X-Frame-Options":        "DENY",
+		"Referrer-Policy":        "no-referrer",
+	} {
+		if got := rec.Header().Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if got := rec.Header().Get("Strict-Transport-Security"); got != "" {
+		t.Errorf("Strict-Transport-Security = %q over plain HTTP, want none", got)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.TLS = &tls.ConnectionState{}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if got := rec.Header().Get("Strict-Transport-Security"); got != "max-age=31536000" {
+		t.Errorf("Strict-Transport-Security = %q over TLS, want max-age=31536000", got)
+	}
+}
+
+func TestMaxBodyMiddleware(t *testing.T) {
+	called := false
+	h := maxBodyMiddleware(64)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		handleEcho(1<<20)(w, r)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(strings.Repeat("x", 65)))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge || called {
+		t.Errorf("declared oversized body: status %d (handler called: %v), want 413 without calling the handler", rec.Code, called)
+	}
+
+	// Without a Content-Length the limit is enforced as the body is read.
+	req = httptest.NewRequest(http.MethodPost, "/echo", io.MultiReader(strings.NewReader(strings.Repeat("x", 65))))
+	req.ContentLength = -1
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("streamed oversized body: status %d, want 413", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(strings.Repeat("x", 64)))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("body at the limit: status %d, want 200", rec.Code)
+	}
+}
+
+func TestConcurrencyLimitRejectsExcessRequests(t *testing.T) {
+	const max = 2
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	h := concurrencyLimitMiddleware(max)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < max; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serve(h, http.MethodGet, "/")
+		}()
+		<-entered
+	}
+
+	rec := serve(h, http.MethodGet, "/")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("request over the limit: status %d, want 503", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want 1", got)
+	}
+
+	close(release)
+	wg.Wait()
+	go func() { <-entered }()
+	if rec := serve(h, http.MethodGet, "/"); rec.Code != http.StatusOK {
+		t.Errorf("request after the slow ones finished: status %d, want 200", rec.Code)
+	}
+}
+
+func TestCombinedLogFormat(t *testing.T) {
+	var out bytes.Buffer
+	h := loggingMiddleware(accessLogCLF, &out, false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/greet?name=a%20b", nil)
+	req.RemoteAddr = "192.0.2.7:41234"
+	req.Header.Set("Referer", "https://example.com/")
+	req.Header.Set("User-Agent", `curl/8.0 "quoted"`)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	line := regexp.MustCompile(`^192\.0\.2\.7 - - \[\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /greet\?name=a%20b HTTP/1\.1" 200 5 "https://example\.com/" "curl/8\.0 \\"quoted\\""\n$`)
+	if !line.Match(out.Bytes()) {
+		t.Errorf("log line %q does not match %s", out.String(), line)
+	}
+
+	out.Reset()
+	h = loggingMiddleware(accessLogCLF, &out, false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/item", nil))
+	if !strings.HasSuffix(out.String(), `"DELETE /item HTTP/1.1" 204 - "-" "-"`+"\n") {
+		t.Errorf("log line %q, want - for the empty size, referer and user agent", out.String())
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"net/http"
+	"net/http/pprof"
+)
+
+const pprofPrefix = "/debug/pprof/"
+
+// registerPprof mounts the runtime profiling handlers through handle, each
+// guarded by the bearer token.
+func registerPprof(handle func(pattern, description string, h http.Handler), token string) {
+	guard := bearerAuthMiddleware(token)
+	handle("GET "+pprofPrefix, "pprof profile index", guard(http.HandlerFunc(pprof.Index)))
+	handle("GET "+pprofPrefix+"cmdline", "pprof command line", guard(http.HandlerFunc(pprof.Cmdline)))
+	handle("GET "+pprofPrefix+"profile", "pprof CPU profile", guard(http.HandlerFunc(pprof.Profile)))
+	// A pattern without a method would conflict with the GET index pattern
+	// above, so the two methods symbol accepts are registered separately.
+	handle("GET "+pprofPrefix+"symbol", "pprof symbol lookup", guard(http.HandlerFunc(pprof.Symbol)))
+	handle("POST "+pprofPrefix+"symbol", "pprof symbol lookup", guard(http.HandlerFunc(pprof.Symbol)))
+	handle("GET "+pprofPrefix+"trace", "pprof execution trace", guard(http.HandlerFunc(pprof.Trace)))
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// pprofMux returns a mux with the root route, plus pprof when enabled.
+func pprofMux(enabled bool, token string) http.Handler {
+	m := http.NewServeMux()
+	handle := func(pattern, _ string, h http.Handler) { m.Handle(pattern, h) }
+	handle("GET /{$}", "", http.NotFoundHandler())
+	if enabled {
+		registerPprof(handle, token)
+	}
+	return withJSONErrors(m)
+}
+
+func TestPprofDisabled(t *testing.T) {
+	h := pprofMux(false, "")
+	if rec := serve(h, http.MethodGet, pprofPrefix); rec.Code != http.StatusNotFound {
+		t.Errorf("status %d, want 404", rec.Code)
+	}
+}
+
+func TestPprofRequiresToken(t *testing.T) {
+	h := pprofMux(true, "s3cret")
+
+	if rec := serve(h, http.MethodGet, pprofPrefix); rec.Code != http.StatusUnauthorized {
+		t.Errorf("no token: status %d, want 401", rec.Code)
+	}
+	req := httptest.NewRequest(http.MethodGet, pprofPrefix, nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("wrong token: status %d, want 401", rec.Code)
+	}
+
+	for _, r := range []struct{ method, path string }{
+		{http.MethodGet, pprofPrefix},
+		{http.MethodGet, pprofPrefix + "cmdline"},
+		{http.MethodGet, pprofPrefix + "goroutine?debug=1"},
+		{http.MethodGet, pprofPrefix + "symbol"},
+		{http.MethodPost, pprofPrefix + "symbol"},
+	} {
+		req := httptest.NewRequest(r.method, r.path, strings.NewReader(""))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s %s with token: status %d, want 200", r.method, r.path, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// proxyRoute forwards every request under prefix to upstream.
+type proxyRoute struct {
+	prefix   string
+	upstream *url.URL
+}
+
+// builtinPaths are the paths served by the server itself, which a proxy
+// prefix may not overlap. Prefixes ending in "/" cover their subtree. The
+// routes under them are reserved even when disabled, so enabling one later
+// can't clash with a proxy route.
+var builtinPaths = []string{"/health", "/livez", "/readyz", metricsPath, "/version", "/echo", wsPath, staticPrefix, pprofPrefix, "/admin/"}
+
+// parseProxyRoutes parses "prefix=upstream" entries such as
+// "/api/=http://backend:9000". Each prefix becomes a mux pattern, so it must
+// be a plain path without wildcards, and must not overlap a built-in route
+// or repeat another proxy prefix.
+func parseProxyRoutes(specs []string) ([]proxyRoute, error) {
+	routes := make([]proxyRoute, 0, len(specs))
+	seen := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		prefix, raw, ok := strings.Cut(spec, "=")
+		if !ok || !strings.HasPrefix(prefix, "/") || strings.ContainsAny(prefix, "{} \t") {
+			return nil, fmt.Errorf("proxy route %q: want /prefix=http://upstream", spec)
+		}
+		for _, p := range builtinPaths {
+			if pathsOverlap(prefix, p) {
+				return nil, fmt.Errorf("proxy route %q: prefix overlaps the built-in route %s", spec, p)
+			}
+		}
+		if seen[prefix] {
+			return nil, fmt.Errorf("proxy route %q: duplicate prefix %s", spec, prefix)
+		}
+		seen[prefix] = true
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("proxy route %q: upstream must be an http or https URL", spec)
+		}
+		routes = append(routes, proxyRoute{prefix: prefix, upstream: u})
+	}
+	return routes, nil
+}
+
+// redactProxyRoutes returns specs with any user:password in the upstream
+// URLs replaced by "xxxxx", as url.URL.Redacted does. An upstream that
+// doesn't parse is replaced entirely, since there is no telling which part
+// of it is secret.
+func redactProxyRoutes(specs []string) []string {
+	if specs == nil {
+		return nil
+	}
+	out := make([]string, len(specs))
+	for i, spec := range specs {
+		prefix, raw, _ := strings.Cut(spec, "=")
+		if u, err := url.Parse(raw); err == nil {
+			out[i] = prefix + "=" + u.Redacted()
+		} else {
+			out[i] = prefix + "=***"
+		}
+	}
+	return out
+}
+
+// pathsOverlap reports whether two route paths would serve any of the same
+// requests: they name the same path, with or without a trailing slash, or
+// one is a subtree ("/" suffix) containing the other.
+func pathsOverlap(a, b string) bool {
+	if strings.TrimSuffix(a, "/") == strings.TrimSuffix(b, "/") {
+		return true
+	}
+	return strings.HasSuffix(a, "/") && strings.HasPrefix(b, a) ||
+		strings.HasSuffix(b, "/") && strings.HasPrefix(a, b)
+}
+
+// newProxy returns a reverse proxy to upstream. The request path is kept
+// as is (joined onto the upstream's base path), X-Forwarded-* headers are
+// set, and the request ID and trace context are passed along. Upstream
+// failures become a 502 with a JSON body. responseTimeout bounds the wait
+// for upstream response headers; it is consulted for every request so it
+// can be changed while the server runs, and a non-positive value means no
+// limit beyond the server's own timeouts.
+func newProxy(upstream *url.URL, responseTimeout func() time.Duration, trustProxy bool) http.Handler {
+	transport := &headerTimeoutTransport{
+		base:    http.DefaultTransport.(*http.Transport).Clone(),
+		timeout: responseTimeout,
+	}
+
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(upstream)
+			if trustProxy {
+				// Keep the chain of proxies in front of us; SetXForwarded
+				// appends our client to it.
+				pr.Out.Header["X-Forwarded-For"] = pr.In.Header["X-Forwarded-For"]
+			}
+			pr.SetXForwarded()
+			if id := requestIDFromContext(pr.In.Context()); id != "" {
+				pr.Out.Header.Set(requestIDHeader, id)
+			}
+			tracePropagator.Inject(pr.In.Context(), propagation.HeaderCarrier(pr.Out.Header))
+		},
+		Transport: transport,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			// A chunked body cut off by maxBodyMiddleware fails the upstream
+			// request, but it is the client's fault, not the upstream's.
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeJSON(w, http.StatusRequestEntityTooLarge, errorResponse{Error: "request body too large"})
+				return
+			}
+			slog.Warn("Proxy request failed",
+				"request_id", requestIDFromContext(r.Context()),
+				"upstream", upstream.String(),
+				"path", r.URL.Path,
+				"error", err,
+			)
+			writeJSON(w, http.StatusBadGateway, errorResponse{Error: "bad gateway", Path: r.URL.Path})
+		},
+	}
+}
+
+// headerTimeoutTransport gives up on an upstream request whose response
+// headers have not arrived within timeout. It does the job of
+// http.Transport.ResponseHeaderTimeout, which is fixed once the transport is
+// in use.
+type headerTimeoutTransport struct {
+	base    http.RoundTripper
+	timeout func() time.Duration
+}
+
+func (t *headerTimeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	d := t.timeout()
+	if d <= 0 {
+		return t.base.RoundTrip(req)
+	}
+	ctx, cancel := context.WithCancel(req.Context())
+	timer := time.AfterFunc(d, cancel)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if !timer.Stop() {
+		if err == nil {
+			resp.Body.Close()
+		}
+		return nil, fmt.Errorf("timeout awaiting response headers after %s", d)
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		// The body is the upgraded connection, which ReverseProxy needs
+		// unwrapped; it outlives this request's context anyway.
+		return resp, nil
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose releases a request's context once its response body has
+// been read.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
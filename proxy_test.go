@@ -0,0 +1,151 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProxyForwardsToUpstream(t *testing.T) {
+	var got *http.Request
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		w.Header().Set("X-Upstream", "yes")
+		io.WriteString(w, "from upstream")
+	}))
+	defer upstream.Close()
+
+	u, _ := url.Parse(upstream.URL + "/base")
+	h := requestIDMiddleware(newProxy(u, func() time.Duration { return time.Second }, false))
+	req := httptest.NewRequest(http.MethodGet, "/api/items?id=7", nil)
+	req.RemoteAddr = "192.0.2.10:4321"
+	req.Header.Set(requestIDHeader, "proxy-test-id")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "from upstream" || rec.Header().Get("X-Upstream") != "yes" {
+		t.Fatalf("response = %d %q (X-Upstream %q), want the upstream's", rec.Code, rec.Body, rec.Header().Get("X-Upstream"))
+	}
+	if got.URL.Path != "/base/api/items" || got.URL.RawQuery != "id=7" {
+		t.Errorf("upstream saw %s?%s, want /base/api/items?id=7", got.URL.Path, got.URL.RawQuery)
+	}
+	for header, want := range map[string]string{
+		"X-Forwarded-For":   "192.0.2.10",
+		"X-Forwarded-Host":  "example.com",
+		"X-Forwarded-Proto": "http",
+		requestIDHeader:     "proxy-test-id",
+	} {
+		if v := got.Header.Get(header); v != want {
+			t.Errorf("upstream %s = %q, want %q", header, v, want)
+		}
+	}
+}
+
+func TestProxyKeepsForwardedChainFromTrustedProxy(t *testing.T) {
+	var xff string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		xff = r.Header.Get("X-Forwarded-For")
+	}))
+	defer upstream.Close()
+
+	u, _ := url.Parse(upstream.URL)
+	req := httptest.NewRequest(http.MethodGet, "/api/", nil)
+	req.RemoteAddr = "10.0.0.2:4321"
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	newProxy(u, func() time.Duration { return time.Second }, true).ServeHTTP(httptest.NewRecorder(), req)
+	if xff != "198.51.100.7, 10.0.0.2" {
+		t.Errorf("X-Forwarded-For = %q, want %q", xff, "198.51.100.7, 10.0.0.2")
+	}
+}
+
+func TestProxyUnreachableUpstream(t *testing.T) {
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	u, _ := url.Parse(upstream.URL)
+	upstream.Close()
+
+	rec := httptest.NewRecorder()
+	newProxy(u, func() time.Duration { return time.Second }, false).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/", nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("status %d, want 502", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), `"bad gateway"`) {
+		t.Errorf("body = %q, want a JSON bad gateway error", rec.Body)
+	}
+}
+
+func TestProxyOversizedChunkedBody(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	}))
+	defer upstream.Close()
+
+	u, _ := url.Parse(upstream.URL)
+	h := maxBodyMiddleware(16)(newProxy(u, func() time.Duration { return time.Second }, false))
+	req := httptest.NewRequest(http.MethodPost, "/api/", strings.NewReader(strings.Repeat("x", 100)))
+	req.ContentLength = -1
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status %d, want 413", rec.Code)
+	}
+}
+
+func TestParseProxyRoutes(t *testing.T) {
+	routes, err := parseProxyRoutes([]string{"/api/=http://backend:9000", "/api/v2/=https://v2.example", "/legacy=http://old"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 3 || routes[0].prefix != "/api/" || routes[0].upstream.Host != "backend:9000" {
+		t.Errorf("routes = %+v", routes)
+	}
+
+	for _, spec := range []string{
+		"api=http://backend",       // not a path
+		"/api/=backend:9000",       // no scheme
+		"/api/=ftp://backend",      // not http
+		"/{id}/=http://backend",    // wildcard
+		"/a b=http://backend",      // not a single path
+		"/echo=http://127.0.0.1:9", // built-in route
+		"/health/=http://backend",  // built-in route, subtree form
+		"/admin/x=http://backend",  // inside a built-in subtree
+		"/debug/=http://backend",   // covers a built-in subtree
+		"/=http://backend",         // covers everything
+		"/static=http://backend",   // built-in subtree without the slash
+	} {
+		if _, err := parseProxyRoutes([]string{spec}); err == nil {
+			t.Errorf("parseProxyRoutes(%q) succeeded, want an error", spec)
+		}
+	}
+	if _, err := parseProxyRoutes([]string{"/api/=http://a", "/api/=http://b"}); err == nil {
+		t.Error("duplicate prefix accepted")
+	}
+}
+
+func TestProxyResponseTimeoutIsLive(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		io.WriteString(w, "slow")
+	}))
+	defer upstream.Close()
+
+	timeout := time.Second
+	u, _ := url.Parse(upstream.URL)
+	h := newProxy(u, func() time.Duration { return timeout }, false)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "slow" {
+		t.Fatalf("within timeout: %d %q, want 200 slow", rec.Code, rec.Body)
+	}
+
+	timeout = 50 * time.Millisecond
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/", nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("after lowering the timeout: status %d, want 502", rec.Code)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proxyProtoV2Signature starts every PROXY protocol version 2 header.
+var proxyProtoV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyProtoV1MaxLen is the longest possible version 1 header line,
+// including the trailing CRLF.
+const proxyProtoV1MaxLen = 107
+
+// proxyProtoListener wraps a listener whose connections come from a load
+// balancer speaking the PROXY protocol (version 1 or 2), so that each
+// connection's RemoteAddr is the original client rather than the balancer.
+// A connection without a valid header is closed, so the listener must only
+// be reachable through the balancer: anyone connecting directly could
+// claim any address.
+type proxyProtoListener struct {
+	net.Listener
+	headerTimeout time.Duration
+}
+
+func newProxyProtoListener(ln net.Listener, headerTimeout time.Duration) net.Listener {
+	return &proxyProtoListener{Listener: ln, headerTimeout: headerTimeout}
+}
+
+// Accept returns the next connection without reading its header; that
+// happens on first use, in the connection's own goroutine, so a slow client
+// can't hold up the accept loop.
+func (l *proxyProtoListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyProtoConn{Conn: conn, br: bufio.NewReader(conn), headerTimeout: l.headerTimeout}, nil
+}
+
+type proxyProtoConn struct {
+	net.Conn
+	br            *bufio.Reader
+	headerTimeout time.Duration
+
+	once   sync.Once
+	remote net.Addr // nil for LOCAL or UNKNOWN headers
+	err    error
+}
+
+func (c *proxyProtoConn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.br.Read(b)
+}
+
+// RemoteAddr returns the client address from the PROXY header, or the
+// peer address if the header carried none.
+func (c *proxyProtoConn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyProtoConn) readHeader() {
+	if c.headerTimeout > 0 {
+		c.Conn.SetReadDeadline(time.Now().Add(c.headerTimeout))
+		defer c.Conn.SetReadDeadline(time.Time{})
+	}
+	c.remote, c.err = parseProxyHeader(c.br)
+	if c.err != nil {
+		slog.Warn("Rejected connection with invalid PROXY protocol header", "peer", c.Conn.RemoteAddr().String(), "error", c.err)
+		c.err = fmt.Errorf("proxy protocol: %w", c.err)
+		c.Conn.Close()
+	}
+}
+
+// parseProxyHeader consumes a version 1 or version 2 PROXY protocol header
+// from br and returns the source address it carries.
+func parseProxyHeader(br *bufio.Reader) (net.Addr, error) {
+	sig, err := br.Peek(len(proxyProtoV2Signature))
+	if bytes.Equal(sig, proxyProtoV2Signature) {
+		return parseProxyHeaderV2(br)
+	}
+	if bytes.HasPrefix(sig, []byte("PROXY ")) {
+		return parseProxyHeaderV1(br)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nil, errors.New("missing PROXY protocol header")
+}
+
+// parseProxyHeaderV1 parses a human-readable header such as
+// "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n".
+func parseProxyHeaderV1(br *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < proxyProtoV1MaxLen {
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	s, ok := strings.CutSuffix(string(line), "\r\n")
+	if !ok {
+		return nil, errors.New("v1 header is not terminated by CRLF")
+	}
+	fields := strings.Split(s, " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("malformed v1 header %q", s)
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil || (fields[1] == "TCP4") != (ip.To4() != nil) {
+		return nil, fmt.Errorf("malformed v1 header %q", s)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// parseProxyHeaderV2 parses a binary header. Only TCP over IPv4 and IPv6
+// addresses are used; other families are accepted but keep the peer
+// address.
+func parseProxyHeaderV2(br *bufio.Reader) (net.Addr, error) {
+	var hdr [16]byte
+	if _, err := io.ReadFull(br, hdr[:]); err != nil {
+		return nil, err
+	}
+	if hdr[12]>>4 != 2 {
+		return nil, fmt.Errorf("unsupported v2 version %d", hdr[12]>>4)
+	}
+	cmd, family := hdr[12]&0x0F, hdr[13]
+	body := make([]byte, binary.BigEndian.Uint16(hdr[14:16]))
+	if _, err := io.ReadFull(br, body); err != nil {
+		return nil, err
+	}
+
+	switch cmd {
+	case 0x0: // LOCAL: a health check from the balancer itself
+		return nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, fmt.Errorf("unsupported v2 command %d", cmd)
+	}
+	switch family {
+	case 0x11: // TCP over IPv4
+		if len(body) < 12 {
+			return nil, errors.New("short v2 IPv4 address block")
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:4]), Port: int(binary.BigEndian.Uint16(body[8:10]))}, nil
+	case 0x21: // TCP over IPv6
+		if len(body) < 36 {
+			return nil, errors.New("short v2 IPv6 address block")
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:16]), Port: int(binary.BigEndian.Uint16(body[32:34]))}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveProxyProto serves h on a PROXY protocol listener and returns its
+// address.
+func serveProxyProto(t *testing.T, h http.Handler) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: h}
+	go srv.Serve(newProxyProtoListener(ln, time.Second))
+	t.Cleanup(func() { srv.Close() })
+	return ln.Addr().String()
+}
+
+// roundTrip sends header followed by a GET request on a fresh connection
+// and returns the response, or the read error if the server hung up.
+func roundTrip(t *testing.T, addr string, header []byte) (*http.Response, error) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write(header)
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: test\r\nConnection: close\r\n\r\n")
+	return http.ReadResponse(bufio.NewReader(conn), nil)
+}
+
+func echoClientIP(w http.ResponseWriter, r *http.Request) {
+	io.WriteString(w, r.RemoteAddr+" "+clientIP(r, false))
+}
+
+func TestProxyProtoV1(t *testing.T) {
+	addr := serveProxyProto(t, http.HandlerFunc(echoClientIP))
+	resp, err := roundTrip(t, addr, []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if got, want := string(body), "192.0.2.1:56324 192.0.2.1"; got != want {
+		t.Errorf("handler saw %q, want %q", got, want)
+	}
+}
+
+func TestProxyProtoV2(t *testing.T) {
+	addr := serveProxyProto(t, http.HandlerFunc(echoClientIP))
+	hdr := append([]byte(nil), proxyProtoV2Signature...)
+	hdr = append(hdr, 0x21, 0x11) // version 2 PROXY, TCP over IPv4
+	hdr = binary.BigEndian.AppendUint16(hdr, 12)
+	hdr = append(hdr, 203, 0, 113, 5, 10, 0, 0, 1)
+	hdr = binary.BigEndian.AppendUint16(hdr, 40000)
+	hdr = binary.BigEndian.AppendUint16(hdr, 443)
+
+	resp, err := roundTrip(t, addr, hdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if got, want := string(body), "203.0.113.5:40000 203.0.113.5"; got != want {
+		t.Errorf("handler saw %q, want %q", got, want)
+	}
+}
+
+func TestProxyProtoRejectsMissingHeader(t *testing.T) {
+	addr := serveProxyProto(t, http.HandlerFunc(echoClientIP))
+	if resp, err := roundTrip(t, addr, nil); err == nil {
+		t.Errorf("got status %d for a connection without a PROXY header, want it closed", resp.StatusCode)
+	}
+}
+
+func TestParseProxyHeaderV1Malformed(t *testing.T) {
+	for _, h := range []string{
+		"PROXY TCP4 192.0.2.1 198.51.100.1 56324\r\n",     // missing port
+		"PROXY TCP4 2001:db8::1 198.51.100.1 1 2\r\n",     // family mismatch
+		"PROXY TCP4 192.0.2.1 198.51.100.1 99999 443\r\n", // port out of range
+		"PROXY TCP4 192.0.2.1 198.51.100.1 1 2\n",         // bare LF
+	} {
+		if _, err := parseProxyHeader(bufio.NewReader(strings.NewReader(h))); err == nil {
+			t.Errorf("parseProxyHeader(%q) succeeded, want an error", h)
+		}
+	}
+	addr, err := parseProxyHeader(bufio.NewReader(strings.NewReader("PROXY UNKNOWN\r\n")))
+	if err != nil || addr != nil {
+		t.Errorf("UNKNOWN header: addr %v, err %v; want nil, nil", addr, err)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const defaultRateBurst = 20
+
+// clientIdleTTL is how long a client's limiter may sit unused before it is
+// dropped. Any limiter idle this long has refilled anyway for all but the
+// slowest rates.
+const clientIdleTTL = 10 * time.Minute
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// rateLimiter keeps a token bucket limiter per client key: each client may
+// make burst requests at once and then rate requests per second. A zero
+// rate lets every request through, so limiting can be switched on by a
+// reload.
+type rateLimiter struct {
+	mu         sync.Mutex
+	rate       float64
+	burst      int
+	clients    map[string]*clientLimiter
+	lastSweep  time.Time
+	trustProxy bool
+	now        func() time.Time
+}
+
+func newRateLimiter(r float64, burst int, trustProxy bool) *rateLimiter {
+	return &rateLimiter{
+		rate:       r,
+		burst:      burst,
+		clients:    make(map[string]*clientLimiter),
+		trustProxy: trustProxy,
+		now:        time.Now,
+	}
+}
+
+// setLimits changes the rate and burst, including for clients already being
+// tracked.
+func (rl *rateLimiter) setLimits(r float64, burst int) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.rate, rl.burst = r, burst
+	now := rl.now()
+	for _, c := range rl.clients {
+		c.limiter.SetLimitAt(now, rate.Limit(r))
+		c.limiter.SetBurstAt(now, burst)
+	}
+}
+
+// allow takes a token from key's bucket. If none is available it reports
+// how long until one will be.
+func (rl *rateLimiter) allow(key string) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if rl.rate <= 0 {
+		return true, 0
+	}
+
+	now := rl.now()
+	if now.Sub(rl.lastSweep) > time.Minute {
+		rl.sweep(now)
+	}
+
+	c, ok := rl.clients[key]
+	if !ok {
+		c = &clientLimiter{limiter: rate.NewLimiter(rate.Limit(rl.rate), rl.burst)}
+		rl.clients[key] = c
+	}
+	c.lastSeen = now
+
+	res := c.limiter.ReserveN(now, 1)
+	if !res.OK() {
+		return false, time.Second
+	}
+	if wait := res.DelayFrom(now); wait > 0 {
+		res.CancelAt(now)
+		return false, wait
+	}
+	return true, 0
+}
+
+// sweep drops limiters that have not been used recently so the map does not
+// grow with every client ever seen.
+func (rl *rateLimiter) sweep(now time.Time) {
+	for k, c := range rl.clients {
+		if now.Sub(c.lastSeen) > clientIdleTTL {
+			delete(rl.clients, k)
+		}
+	}
+	rl.lastSweep = now
+}
+
+// rateLimitMiddleware rejects requests from clients that have exhausted
+// their bucket with 429 Too Many Requests and a Retry-After header. Clients
+// are keyed by IP address.
+func rateLimitMiddleware(rl *rateLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ok, wait := rl.allow(clientIP(r, rl.trustProxy))
+			if !ok {
+				secs := int(math.Ceil(wait.Seconds()))
+				if secs < 1 {
+					secs = 1
+				}
+				w.Header().Set("Retry-After", strconv.Itoa(secs))
+				writeJSON(w, http.StatusTooManyRequests, errorResponse{Error: "rate limit exceeded"})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// httpsRedirectHandler sends every request to its https:// equivalent on
+// the port of httpsAddr, with a 301 so clients remember the move.
+func httpsRedirectHandler(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		if host == "" {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "missing Host header", Path: r.URL.Path})
+			return
+		}
+		switch {
+		case port != "443":
+			host = net.JoinHostPort(host, port)
+		case strings.Contains(host, ":"):
+			host = "[" + host + "]" // IPv6 literal
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPSRedirect(t *testing.T) {
+	for _, tc := range []struct {
+		httpsAddr, host, target, want string
+	}{
+		{":443", "example.com", "/a/b?q=1", "https://example.com/a/b?q=1"},
+		{":443", "example.com:8080", "/", "https://example.com/"},
+		{":8443", "example.com:8080", "/x", "https://example.com:8443/x"},
+		{":443", "[2001:db8::1]:80", "/", "https://[2001:db8::1]/"},
+		{"0.0.0.0:8443", "[2001:db8::1]", "/", "https://[2001:db8::1]:8443/"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+		req.Host = tc.host
+		rec := httptest.NewRecorder()
+		httpsRedirectHandler(tc.httpsAddr).ServeHTTP(rec, req)
+		if rec.Code != http.StatusMovedPermanently {
+			t.Errorf("%s%s to %s: status %d, want 301", tc.host, tc.target, tc.httpsAddr, rec.Code)
+		}
+		if got := rec.Header().Get("Location"); got != tc.want {
+			t.Errorf("%s%s to %s: Location %q, want %q", tc.host, tc.target, tc.httpsAddr, got, tc.want)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Host = ""
+	rec := httptest.NewRecorder()
+	httpsRedirectHandler(":443").ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("missing Host: status %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"log/slog"
+	"reflect"
+	"sync"
+)
+
+// reloader applies a freshly loaded configuration to the running server.
+// Only settings with an applier, keyed by yaml name, can change live; the
+// rest keep their startup values and are logged as requiring a restart.
+type reloader struct {
+	mu       sync.Mutex
+	cfg      Config
+	appliers map[string]func(Config)
+}
+
+func newReloader(cfg Config, appliers map[string]func(Config)) *reloader {
+	return &reloader{cfg: cfg, appliers: appliers}
+}
+
+// current returns the configuration in effect.
+func (rl *reloader) current() Config {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.cfg
+}
+
+// apply compares next with the configuration in effect and applies every
+// changed setting that can change live. Appliers are called with the
+// updated configuration, so settings that belong together, such as
+// rate_limit and rate_burst, see each other's new values.
+func (rl *reloader) apply(next Config) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	cur := reflect.ValueOf(&rl.cfg).Elem()
+	nv := reflect.ValueOf(next)
+	t := cur.Type()
+	var changed []func(Config)
+	var applied, skipped []string
+	for i := 0; i < t.NumField(); i++ {
+		if !t.Field(i).IsExported() {
+			continue
+		}
+		if reflect.DeepEqual(cur.Field(i).Interface(), nv.Field(i).Interface()) {
+			continue
+		}
+		key := t.Field(i).Tag.Get("yaml")
+		fn, ok := rl.appliers[key]
+		if !ok {
+			skipped = append(skipped, key)
+			continue
+		}
+		cur.Field(i).Set(nv.Field(i))
+		changed = append(changed, fn)
+		applied = append(applied, key)
+	}
+	for _, fn := range changed {
+		fn(rl.cfg)
+	}
+
+	for _, key := range skipped {
+		slog.Warn("Setting changed but requires restart, keeping current value", "setting", key)
+	}
+	slog.Info("Configuration reloaded", "applied", applied, "config", rl.cfg)
+}
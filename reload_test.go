@@ -0,0 +1,26 @@
+package main
+
+import (
+	"log/slog"
+	"testing"
+)
+
+func TestReloadChangesLogLevel(t *testing.T) {
+	defer logLevel.Set(logLevel.Level())
+	logLevel.Set(slog.LevelInfo)
+
+	rl := newReloader(mustLoadConfig(t), map[string]func(Config){"log_level": applyLogLevel})
+	rl.apply(mustLoadConfig(t, "-log-level", "warn", "-addr", ":9999"))
+
+	if got := logLevel.Level(); got != slog.LevelWarn {
+		t.Errorf("log level = %v, want WARN", got)
+	}
+	cur := rl.current()
+	if cur.LogLevel != "warn" {
+		t.Errorf("current log_level = %q, want warn", cur.LogLevel)
+	}
+	// addr has no applier, so it keeps its startup value.
+	if cur.Addr != defaultAddr {
+		t.Errorf("current addr = %q, want the startup value %q", cur.Addr, defaultAddr)
+	}
+}
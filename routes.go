@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// routeInfo describes one registered route. Method is empty for routes
+// that serve any method.
+type routeInfo struct {
+	Method      string `json:"method,omitempty"`
+	Pattern     string `json:"pattern"`
+	Description string `json:"description"`
+}
+
+// routeTable records routes as they are registered, for /admin/routes.
+type routeTable struct {
+	mu     sync.Mutex
+	routes []routeInfo
+}
+
+// add records a ServeMux pattern and what it serves.
+func (rt *routeTable) add(pattern, description string) {
+	method, path, ok := strings.Cut(pattern, " ")
+	if !ok {
+		method, path = "", pattern
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.routes = append(rt.routes, routeInfo{Method: method, Pattern: strings.TrimLeft(path, " "), Description: description})
+}
+
+// ServeHTTP lists the registered routes as JSON, in registration order.
+func (rt *routeTable) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.mu.Lock()
+	routes := append([]routeInfo(nil), rt.routes...)
+	rt.mu.Unlock()
+	writeJSON(w, http.StatusOK, routes)
+}
+
+// patternPath returns the path part of a ServeMux pattern, dropping any
+// leading method such as "GET " and a trailing exact-match "{$}".
+func patternPath(pattern string) string {
+	if i := strings.IndexByte(pattern, ' '); i >= 0 {
+		pattern = strings.TrimLeft(pattern[i:], " ")
+	}
+	return strings.TrimSuffix(pattern, "{$}")
+}
+
+// withJSONErrors serves requests through mux, replacing the mux's plain
+// text 404 and 405 replies with JSON bodies. The Allow header the mux sets
+// on a 405 is kept.
+func withJSONErrors(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h, pattern := mux.Handler(r)
+		if pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		h.ServeHTTP(&muxErrorWriter{ResponseWriter: w, r: r}, r)
+	})
+}
+
+// muxErrorWriter intercepts the status the mux chose for an unmatched
+// request and writes the JSON equivalent, discarding the mux's own body.
+type muxErrorWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	intercepted bool
+}
+
+func (m *muxErrorWriter) WriteHeader(code int) {
+	switch code {
+	case http.StatusNotFound:
+		m.intercepted = true
+		handleNotFound(m.ResponseWriter, m.r)
+	case http.StatusMethodNotAllowed:
+		m.intercepted = true
+		writeJSON(m.ResponseWriter, code, errorResponse{Error: "method not allowed", Path: m.r.URL.Path})
+	default:
+		m.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (m *muxErrorWriter) Write(b []byte) (int, error) {
+	if m.intercepted {
+		return len(b), nil
+	}
+	return m.ResponseWriter.Write(b)
+}
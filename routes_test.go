@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHealthRejectsOtherMethods(t *testing.T) {
+	m := http.NewServeMux()
+	m.HandleFunc("GET /health", handleHealth)
+	h := withJSONErrors(m)
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, "/health", nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s /health: status %d, want 200", method, rec.Code)
+		}
+	}
+
+	for _, method := range []string{http.MethodPost, http.MethodDelete} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, "/health", nil))
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Fatalf("%s /health: status %d, want 405", method, rec.Code)
+		}
+		if got := rec.Header().Get("Allow"); got != "GET, HEAD" {
+			t.Errorf("%s /health: Allow = %q, want %q", method, got, "GET, HEAD")
+		}
+		var body errorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Error != "method not allowed" {
+			t.Errorf("%s /health: body %q, want a JSON method not allowed error", method, rec.Body)
+		}
+	}
+}
+
+func TestRouteTableListsRoutes(t *testing.T) {
+	rt := &routeTable{}
+	rt.add("GET /health", "health check")
+	rt.add("/static/", "static files")
+	rt.add("POST  /echo", "echo")
+
+	rec := serve(rt, http.MethodGet, "/admin/routes")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", rec.Code)
+	}
+	var got []routeInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []routeInfo{
+		{Method: "GET", Pattern: "/health", Description: "health check"},
+		{Pattern: "/static/", Description: "static files"},
+		{Method: "POST", Pattern: "/echo", Description: "echo"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("routes = %+v, want %+v", got, want)
+	}
+	if strings.Contains(rec.Body.String(), `"method":""`) {
+		t.Errorf("body %s lists an empty method; want it omitted", rec.Body)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// shutdownServer is the part of *http.Server the shutdown sequence drives.
+type shutdownServer interface {
+	SetKeepAlivesEnabled(v bool)
+	Shutdown(ctx context.Context) error
+	Close() error
+}
+
+// serverGroup shuts several servers down together, concurrently.
+type serverGroup []shutdownServer
+
+func (g serverGroup) SetKeepAlivesEnabled(v bool) {
+	for _, s := range g {
+		s.SetKeepAlivesEnabled(v)
+	}
+}
+
+// Shutdown shuts every server down and returns the first error, once all
+// of them have returned.
+func (g serverGroup) Shutdown(ctx context.Context) error {
+	errs := make(chan error, len(g))
+	for _, s := range g {
+		go func(s shutdownServer) { errs <- s.Shutdown(ctx) }(s)
+	}
+	var first error
+	for range g {
+		if err := <-errs; err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (g serverGroup) Close() error {
+	var first error
+	for _, s := range g {
+		if err := s.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// shutdownManager runs the graceful shutdown sequence: disable keep-alives,
+// wait out the pre-shutdown delay while health checks fail, then drain
+// in-flight requests for up to drainTimeout, then close whatever is left. A
+// signal on the force channel at any point skips straight to closing.
+//
+// Disabling keep-alives first means every response sent from then on
+// carries "Connection: close", so clients with persistent connections
+// reconnect, through the load balancer, to another instance during the
+// delay. By the time Shutdown runs few connections are left idle, and the
+// drain timeout is spent only on requests that are actually in flight.
+type shutdownManager struct {
+	server       shutdownServer
+	delay        time.Duration
+	drainTimeout time.Duration
+	openConns    func() int64
+}
+
+// run shuts the server down and reports whether it finished gracefully.
+func (m *shutdownManager) run(force <-chan struct{}) bool {
+	m.server.SetKeepAlivesEnabled(false)
+	if m.delay > 0 {
+		slog.Info("Shutting down, failing health checks before draining", "delay", m.delay.String())
+		select {
+		case <-time.After(m.delay):
+		case <-force:
+			m.forceClose("Forced shutdown during pre-shutdown delay")
+			return false
+		}
+	}
+
+	slog.Info("Draining connections", "timeout", m.drainTimeout.String())
+	ctx, cancel := context.WithTimeout(context.Background(), m.drainTimeout)
+	defer cancel()
+
+	var forced atomic.Bool
+	drained := make(chan struct{})
+	go func() {
+		select {
+		case <-force:
+			forced.Store(true)
+			cancel()
+		case <-drained:
+		}
+	}()
+	err := m.server.Shutdown(ctx)
+	close(drained)
+
+	switch {
+	case err == nil:
+		slog.Info("Server stopped")
+		return true
+	case forced.Load():
+		m.forceClose("Forced shutdown, closed connections without draining")
+	default:
+		m.forceClose("Drain timed out, forcibly closed connections")
+	}
+	return false
+}
+
+// forceOnSignal returns a channel that is closed when a second signal
+// arrives, so a second signal during shutdown stops waiting for requests to
+// drain. signalled reports whether the shutdown was itself started by a
+// signal; if it was started some other way, such as /admin/shutdown, the
+// first signal only starts the graceful shutdown already under way, as it
+// would have anyway. After forcing, signals get their default behaviour, so
+// another one kills the process outright.
+func forceOnSignal(signals <-chan os.Signal, signalled bool) <-chan struct{} {
+	force := make(chan struct{})
+	go func() {
+		if !signalled {
+			sig := <-signals
+			slog.Info("Signal received, already shutting down gracefully (signal again to force)", "signal", sig.String())
+		}
+		sig := <-signals
+		slog.Warn("Second signal received, forcing shutdown", "signal", sig.String())
+		signal.Reset(os.Interrupt, syscall.SIGTERM)
+		close(force)
+	}()
+	return force
+}
+
+func (m *shutdownManager) forceClose(msg string) {
+	remaining := m.openConns()
+	m.server.Close()
+	slog.Warn(msg, "connections", remaining)
+}
+
+// connCounter tracks the number of open client connections so shutdown can
+// report how many had to be closed forcibly.
+type connCounter struct {
+	n atomic.Int64
+}
+
+func (c *connCounter) track(_ net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		c.n.Add(1)
+	case http.StateHijacked, http.StateClosed:
+		c.n.Add(-1)
+	}
+}
+
+func (c *connCounter) open() int64 {
+	return c.n.Load()
+}
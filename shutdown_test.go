@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeServer records the calls the shutdown sequence makes. Its Shutdown
+// blocks until the context is done, like a server with a request that
+// never finishes.
+type fakeServer struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (s *fakeServer) record(call string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, call)
+}
+
+func (s *fakeServer) recorded() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.calls...)
+}
+
+func (s *fakeServer) SetKeepAlivesEnabled(v bool) {
+	if v {
+		s.record("keepalives on")
+	} else {
+		s.record("keepalives off")
+	}
+}
+
+func (s *fakeServer) Shutdown(ctx context.Context) error {
+	s.record("shutdown")
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (s *fakeServer) Close() error {
+	s.record("close")
+	return nil
+}
+
+func TestSecondSignalForcesShutdown(t *testing.T) {
+	srv := &fakeServer{}
+	sm := &shutdownManager{
+		server:       srv,
+		drainTimeout: time.Minute,
+		openConns:    func() int64 { return 1 },
+	}
+
+	signals := make(chan os.Signal, 1)
+	force := forceOnSignal(signals, true)
+	result := make(chan bool)
+	go func() { result <- sm.run(force) }()
+
+	select {
+	case <-result:
+		t.Fatal("run returned before the second signal")
+	case <-time.After(50 * time.Millisecond):
+	}
+	signals <- syscall.SIGTERM
+
+	select {
+	case graceful := <-result:
+		if graceful {
+			t.Error("run reported a graceful shutdown after a forced one")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not return after the second signal")
+	}
+	calls := srv.recorded()
+	if len(calls) == 0 || calls[len(calls)-1] != "close" {
+		t.Errorf("calls = %v, want the server closed last", calls)
+	}
+}
+
+func TestFirstSignalAfterAdminShutdownStaysGraceful(t *testing.T) {
+	signals := make(chan os.Signal)
+	force := forceOnSignal(signals, false)
+
+	signals <- syscall.SIGTERM
+	select {
+	case <-force:
+		t.Fatal("the first signal forced a shutdown started by /admin/shutdown")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	signals <- syscall.SIGTERM
+	select {
+	case <-force:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the second signal did not force shutdown")
+	}
+}
+
+func TestDrainTimeoutClosesServer(t *testing.T) {
+	srv := &fakeServer{}
+	sm := &shutdownManager{server: srv, drainTimeout: 10 * time.Millisecond, openConns: func() int64 { return 0 }}
+	if sm.run(make(chan struct{})) {
+		t.Error("run reported a graceful shutdown after the drain timed out")
+	}
+	if calls := srv.recorded(); calls[len(calls)-1] != "close" {
+		t.Errorf("calls = %v, want the server closed last", calls)
+	}
+}
+
+func TestShutdownDisablesKeepAlivesFirst(t *testing.T) {
+	srv := &fakeServer{}
+	sm := &shutdownManager{server: srv, delay: 10 * time.Millisecond, drainTimeout: 10 * time.Millisecond, openConns: func() int64 { return 0 }}
+	sm.run(make(chan struct{}))
+
+	want := []string{"keepalives off", "shutdown", "close"}
+	if got := srv.recorded(); !reflect.DeepEqual(got, want) {
+		t.Errorf("calls = %v, want %v", got, want)
+	}
+}
+
+func TestServerGroupFansOut(t *testing.T) {
+	a, b := &fakeServer{}, &fakeServer{}
+	g := serverGroup{a, b}
+	g.SetKeepAlivesEnabled(false)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := g.Shutdown(ctx); err != context.Canceled {
+		t.Errorf("Shutdown = %v, want context.Canceled", err)
+	}
+	for i, s := range []*fakeServer{a, b} {
+		if got, want := s.recorded(), []string{"keepalives off", "shutdown"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("server %d calls = %v, want %v", i, got, want)
+		}
+	}
+}
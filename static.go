@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+const staticPrefix = "/static/"
+
+// staticHandler serves the files under dir at staticPrefix. Requests whose
+// path contains a ".." segment are rejected outright rather than relying
+// only on path cleaning further down.
+func staticHandler(dir string) http.Handler {
+	files := http.StripPrefix(staticPrefix, http.FileServer(http.Dir(dir)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if containsDotDot(r.URL.Path) {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid path", Path: r.URL.Path})
+			return
+		}
+		files.ServeHTTP(w, r)
+	})
+}
+
+func containsDotDot(path string) bool {
+	if !strings.Contains(path, "..") {
+		return false
+	}
+	for _, seg := range strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if seg == ".." {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStaticHandler(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "public")
+	os.Mkdir(dir, 0o755)
+	os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("hello, static"), 0o644)
+	os.WriteFile(filepath.Join(root, "secret.txt"), []byte("top secret"), 0o644)
+	h := staticHandler(dir)
+
+	rec := serve(h, http.MethodGet, "/static/hello.txt")
+	if rec.Code != http.StatusOK || rec.Body.String() != "hello, static" {
+		t.Errorf("hello.txt: %d %q, want 200 with the file", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("hello.txt: Content-Type %q", ct)
+	}
+
+	if rec := serve(h, http.MethodGet, "/static/missing.txt"); rec.Code != http.StatusNotFound {
+		t.Errorf("missing.txt: status %d, want 404", rec.Code)
+	}
+
+	for _, path := range []string{"/static/../secret.txt", "/static/%2e%2e/secret.txt", "/static/..%5csecret.txt"} {
+		rec := serve(h, http.MethodGet, path)
+		if rec.Code != http.StatusBadRequest && rec.Code != http.StatusNotFound {
+			t.Errorf("%s: status %d, want 400 or 404", path, rec.Code)
+		}
+		if rec.Body.String() == "top secret" {
+			t.Errorf("%s: served a file outside the static directory", path)
+		}
+	}
+}
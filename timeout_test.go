@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTimeoutMiddleware(t *testing.T) {
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(500 * time.Millisecond):
+			io.WriteString(w, "too late")
+		case <-r.Context().Done():
+		}
+	})
+	h := timeoutMiddleware(func() time.Duration { return 50 * time.Millisecond }, "/stream/")(slow)
+
+	rec := serve(h, http.MethodGet, "/slow")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("slow handler: status %d, want 503", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("slow handler: Content-Type %q, want application/json", ct)
+	}
+
+	rec = serve(h, http.MethodGet, "/stream/events")
+	if rec.Code != http.StatusOK || rec.Body.String() != "too late" {
+		t.Errorf("exempt path: %d %q, want the handler's own response", rec.Code, rec.Body)
+	}
+
+	fast := timeoutMiddleware(func() time.Duration { return time.Second })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Handler", "fast")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, "done")
+	}))
+	rec = serve(fast, http.MethodGet, "/fast")
+	if rec.Code != http.StatusCreated || rec.Body.String() != "done" || rec.Header().Get("X-Handler") != "fast" {
+		t.Errorf("fast handler: %d %q, want 201 done with its headers", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const (
+	defaultServiceName = "1st-repo"
+	otlpTracesPath     = "/v1/traces"
+)
+
+// tracePropagator reads and writes W3C traceparent headers, both on inbound
+// requests and on the requests the reverse proxy makes upstream.
+var tracePropagator = propagation.TraceContext{}
+
+// newTracerProvider returns a provider that batches spans and exports them
+// to an OTLP/HTTP collector at endpoint, together with a function that
+// flushes and stops it. Following the OpenTelemetry conventions, endpoint is
+// a base URL to which /v1/traces is appended. With no endpoint the provider
+// is a no-op, so spans cost next to nothing and are never exported.
+func newTracerProvider(endpoint, serviceName string) (trace.TracerProvider, func(context.Context) error, error) {
+	if endpoint == "" {
+		return noop.NewTracerProvider(), func(context.Context) error { return nil }, nil
+	}
+	exporter, err := otlptracehttp.New(context.Background(),
+		otlptracehttp.WithEndpointURL(strings.TrimRight(endpoint, "/")+otlpTracesPath))
+	if err != nil {
+		return nil, nil, err
+	}
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		slog.Warn("Failed to export spans", "error", err)
+	}))
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", serviceName),
+			attribute.String("service.version", version),
+		)),
+	)
+	return tp, tp.Shutdown, nil
+}
+
+// tracingMiddleware records a server span for every request, continuing
+// the trace from an inbound traceparent header when there is one. Spans are
+// named after the matched route rather than the raw path, and carry the
+// request ID so traces and logs can be joined.
+func tracingMiddleware(tp trace.TracerProvider) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		annotated := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			span := trace.SpanFromContext(r.Context())
+			span.SetAttributes(
+				attribute.String("http.route", routeLabel(r)),
+				attribute.String("request.id", requestIDFromContext(r.Context())),
+			)
+			next.ServeHTTP(w, r)
+		})
+		return otelhttp.NewHandler(annotated, "http.server",
+			otelhttp.WithTracerProvider(tp),
+			otelhttp.WithPropagators(tracePropagator),
+			otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+				return r.Method + " " + routeLabel(r)
+			}),
+		)
+	}
+}
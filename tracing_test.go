@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"text/template"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracingRecordsSpan(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer tp.Shutdown(context.Background())
+
+	root := handleRoot(template.Must(template.New("greeting").Parse(defaultGreeting)))
+	registerTestRoute("GET /{$}", root)
+	h := requestIDMiddleware(tracingMiddleware(tp)(root))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(requestIDHeader, "trace-test-id")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(spans))
+	}
+	s := spans[0]
+	if s.Name != "GET /" {
+		t.Errorf("span name = %q, want %q", s.Name, "GET /")
+	}
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range s.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	if got := attrs["request.id"].AsString(); got != "trace-test-id" {
+		t.Errorf("request.id = %q, want trace-test-id", got)
+	}
+	if got := attrs["http.status_code"].AsInt64(); got != http.StatusOK {
+		t.Errorf("http.status_code = %d, want 200", got)
+	}
+}
+
+func TestTracingNoopWithoutEndpoint(t *testing.T) {
+	tp, shutdown, err := newTracerProvider("", defaultServiceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := tracingMiddleware(tp)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status %d, want 200", rec.Code)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("shutdown: %v", err)
+	}
+}
+
+func TestTracingAfterShutdown(t *testing.T) {
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(tracetest.NewInMemoryExporter()))
+	h := tracingMiddleware(tp)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	if err := tp.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// A request still in flight when the drain timed out, or a hijacked
+	// /ws connection, finishes its span after shutdown.
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status %d, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsPath = "/ws"
+
+	// wsIdleTimeout closes connections that have not sent a message for
+	// this long; pongs keep a connection alive but do not count as activity.
+	wsIdleTimeout = 5 * time.Minute
+	// wsPingInterval is how often the server pings the client. A client that
+	// sends nothing at all, not even a pong, for wsPongWait is gone.
+	wsPingInterval = 30 * time.Second
+	wsPongWait     = 2 * wsPingInterval
+	wsWriteTimeout = 10 * time.Second
+	// wsCloseTimeout is how long to wait for the client to answer a close
+	// frame before dropping the connection.
+	wsCloseTimeout = time.Second
+)
+
+// wsEcho serves WebSocket connections that echo every text and binary
+// message back to the client. It tracks open connections so they can be
+// closed with a "going away" frame when the server shuts down.
+type wsEcho struct {
+	upgrader  websocket.Upgrader
+	readLimit int64
+
+	mu    sync.Mutex
+	conns map[*wsConn]struct{}
+	wg    sync.WaitGroup
+}
+
+func newWSEcho(readLimit int64) *wsEcho {
+	return &wsEcho{
+		upgrader: websocket.Upgrader{
+			// The endpoint echoes what it is sent and carries no
+			// credentials, so pages from any origin may connect.
+			CheckOrigin: func(*http.Request) bool { return true },
+			Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+				writeJSON(w, status, errorResponse{Error: reason.Error(), Path: r.URL.Path})
+			},
+		},
+		readLimit: readLimit,
+		conns:     make(map[*wsConn]struct{}),
+	}
+}
+
+func (e *wsEcho) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := e.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already replied through upgrader.Error.
+		slog.Debug("WebSocket upgrade failed", "request_id", requestIDFromContext(r.Context()), "error", err)
+		return
+	}
+	// The server's read and write deadlines still apply to the hijacked
+	// connection; from here on the WebSocket code manages its own.
+	conn.NetConn().SetDeadline(time.Time{})
+	conn.SetReadLimit(e.readLimit)
+
+	c := &wsConn{conn: conn, done: make(chan struct{})}
+	if !e.add(c) {
+		c.close(websocket.CloseGoingAway, "server shutting down")
+		c.finish()
+		return
+	}
+	defer e.remove(c)
+	slog.Debug("WebSocket connected", "request_id", requestIDFromContext(r.Context()), "remote_addr", r.RemoteAddr)
+	c.serve()
+}
+
+// add registers c, unless shutdown has already closed the registry.
+func (e *wsEcho) add(c *wsConn) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.conns == nil {
+		return false
+	}
+	e.conns[c] = struct{}{}
+	e.wg.Add(1)
+	return true
+}
+
+func (e *wsEcho) remove(c *wsConn) {
+	e.mu.Lock()
+	delete(e.conns, c)
+	e.mu.Unlock()
+	e.wg.Done()
+}
+
+// shutdown sends a "going away" close frame on every open connection and
+// refuses new ones. It is registered with http.Server.RegisterOnShutdown,
+// since Shutdown does not track hijacked connections itself.
+func (e *wsEcho) shutdown() {
+	e.mu.Lock()
+	conns := e.conns
+	e.conns = nil
+	e.mu.Unlock()
+	for c := range conns {
+		c.close(websocket.CloseGoingAway, "server shutting down")
+	}
+}
+
+// wait blocks until every connection has finished closing, or timeout
+// passes.
+func (e *wsEcho) wait(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		e.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
+
+// wsConn is one upgraded connection. Data messages are read and written
+// only on the serve goroutine; the pinger and shutdown send control frames,
+// which the library allows concurrently.
+type wsConn struct {
+	conn      *websocket.Conn
+	closing   atomic.Bool
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// serve echoes messages until the client closes the connection, breaks the
+// protocol, or goes idle.
+func (c *wsConn) serve() {
+	defer c.finish()
+	go c.pingLoop()
+
+	lastMessage := time.Now()
+	extendDeadline := func() {
+		if !c.closing.Load() {
+			c.conn.SetReadDeadline(earliest(lastMessage.Add(wsIdleTimeout), time.Now().Add(wsPongWait)))
+		}
+	}
+	c.conn.SetPongHandler(func(string) error {
+		extendDeadline()
+		return nil
+	})
+
+	for {
+		extendDeadline()
+		op, msg, err := c.conn.ReadMessage()
+		if err != nil {
+			switch {
+			case errors.Is(err, websocket.ErrReadLimit):
+				c.close(websocket.CloseMessageTooBig, "message too large")
+			case isTimeout(err) && !c.closing.Load():
+				c.close(websocket.CloseNormalClosure, "idle timeout")
+			}
+			return
+		}
+		if op == websocket.TextMessage && !utf8.Valid(msg) {
+			c.close(websocket.CloseInvalidFramePayloadData, "invalid UTF-8")
+			return
+		}
+		c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		if err := c.conn.WriteMessage(op, msg); err != nil {
+			return
+		}
+		lastMessage = time.Now()
+	}
+}
+
+// pingLoop pings the client every wsPingInterval until the connection is
+// done.
+func (c *wsConn) pingLoop() {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// close starts the closing handshake: it sends a close frame and gives the
+// client wsCloseTimeout to answer before the read loop gives up. Only the
+// first call sends anything.
+func (c *wsConn) close(code int, reason string) {
+	if c.closing.Swap(true) {
+		return
+	}
+	msg := websocket.FormatCloseMessage(code, reason)
+	if err := c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsWriteTimeout)); err == nil {
+		c.conn.SetReadDeadline(time.Now().Add(wsCloseTimeout))
+	}
+}
+
+// finish tears the connection down once the read loop has exited.
+func (c *wsConn) finish() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+func earliest(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func dialWS(t *testing.T, srv *httptest.Server) *websocket.Conn {
+	t.Helper()
+	return dialWSWithHeader(t, srv, nil)
+}
+
+func dialWSWithHeader(t *testing.T, srv *httptest.Server, h http.Header) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+wsPath, h)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func TestWebSocketEcho(t *testing.T) {
+	srv := httptest.NewServer(newWSEcho(1024))
+	defer srv.Close()
+	conn := dialWS(t, srv)
+
+	for _, m := range []struct {
+		op   int
+		data []byte
+	}{
+		{websocket.TextMessage, []byte("hello")},
+		{websocket.BinaryMessage, []byte{0, 1, 2, 0xff}},
+	} {
+		if err := conn.WriteMessage(m.op, m.data); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		op, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if op != m.op || !bytes.Equal(data, m.data) {
+			t.Errorf("echoed (%d, %q), want (%d, %q)", op, data, m.op, m.data)
+		}
+	}
+}
+
+func TestWebSocketThroughMiddleware(t *testing.T) {
+	timeout := func() time.Duration { return time.Second }
+	h := loggingMiddleware(accessLogJSON, io.Discard, false)(gzipMiddleware(timeoutMiddleware(timeout, wsPath)(newWSEcho(1024))))
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	// Browsers send Accept-Encoding on the handshake.
+	conn := dialWSWithHeader(t, srv, http.Header{"Accept-Encoding": {"gzip, deflate, br"}})
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("hello")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, data, err := conn.ReadMessage(); err != nil || string(data) != "hello" {
+		t.Errorf("echoed %q, %v; want hello", data, err)
+	}
+}
+
+func TestWebSocketReadLimit(t *testing.T) {
+	srv := httptest.NewServer(newWSEcho(16))
+	defer srv.Close()
+	conn := dialWS(t, srv)
+
+	if err := conn.WriteMessage(websocket.TextMessage, bytes.Repeat([]byte("x"), 17)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Errorf("read error = %v, want close %d", err, websocket.CloseMessageTooBig)
+	}
+}
+
+func TestWebSocketShutdown(t *testing.T) {
+	e := newWSEcho(1024)
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+	conn := dialWS(t, srv)
+
+	// Make sure the connection is registered before shutting down.
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+
+	e.shutdown()
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("read error = %v, want close %d", err, websocket.CloseGoingAway)
+	}
+	e.wait(time.Second)
+}
+
+func TestWebSocketRejectsPlainRequest(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newWSEcho(1024).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, wsPath, nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want 400", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+}